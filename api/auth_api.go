@@ -0,0 +1,167 @@
+package api
+
+import (
+	"net/http"
+	"qlist/db"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/auth"
+	"qlist/pkg/response"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// LocalAuthRequest 定义邮箱注册/登录的请求体
+type LocalAuthRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// LoginResponse 定义登录成功后的响应体
+type LoginResponse struct {
+	Token string       `json:"token"`
+	User  *models.User `json:"user"`
+}
+
+// RegisterLocal godoc
+// @Summary 邮箱注册
+// @Description 在当前站点注册本地账号，注册成功后直接登录
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param register_request body LocalAuthRequest true "注册信息"
+// @Success 200 {object} LoginResponse
+// @Router /api/register/local [post]
+func RegisterLocal(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var req LocalAuthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if !strings.Contains(req.Email, "@") || len(req.Email) > 128 {
+		response.RespondWithError(c, http.StatusBadRequest, "邮箱格式不正确")
+		return
+	}
+	if len(req.Password) < 6 {
+		response.RespondWithError(c, http.StatusBadRequest, "密码长度不能少于6位")
+		return
+	}
+
+	var count int64
+	if err := db.GetDB().Model(&models.User{}).Where("site_id = ? AND provider = ? AND username = ?", site.ID, "local", req.Email).Count(&count).Error; err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "查询用户失败")
+		return
+	}
+	if count > 0 {
+		response.RespondWithError(c, http.StatusConflict, "该邮箱已注册")
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "密码加密失败")
+		return
+	}
+
+	user := models.User{
+		SiteID:   site.ID,
+		Username: req.Email,
+		Provider: "local",
+		Email:    req.Email,
+		Password: string(hashedPassword),
+	}
+	if err := db.GetDB().Create(&user).Error; err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "创建用户失败")
+		return
+	}
+
+	issueSession(c, &user)
+}
+
+// LoginLocal godoc
+// @Summary 邮箱登录
+// @Description 使用当前站点的本地账号登录，成功后签发 JWT 并写入 Cookie
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param login_request body LocalAuthRequest true "登录信息"
+// @Success 200 {object} LoginResponse
+// @Router /api/login/local [post]
+func LoginLocal(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var req LocalAuthRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+
+	var user models.User
+	if err := db.GetDB().Where("site_id = ? AND provider = ? AND username = ?", site.ID, "local", req.Email).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.RespondWithError(c, http.StatusUnauthorized, "邮箱或密码错误")
+			return
+		}
+		response.RespondWithError(c, http.StatusInternalServerError, "查询用户失败")
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		response.RespondWithError(c, http.StatusUnauthorized, "邮箱或密码错误")
+		return
+	}
+
+	issueSession(c, &user)
+}
+
+// Logout godoc
+// @Summary 退出登录
+// @Description 清除登录 Cookie
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /api/logout [post]
+func Logout(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(auth.TokenCookieName, "", -1, "/", "", c.Request.TLS != nil, true)
+	response.RespondWithJSON(c, http.StatusOK, gin.H{"message": "已退出登录"})
+}
+
+// issueSession 为用户签发 JWT，写入 Cookie 并返回登录结果
+func issueSession(c *gin.Context, user *models.User) {
+	token, err := setSessionCookie(c, user)
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "签发登录令牌失败")
+		return
+	}
+
+	user.Password = ""
+	response.RespondWithJSON(c, http.StatusOK, LoginResponse{Token: token, User: user})
+}
+
+// setSessionCookie 为用户签发 JWT 并写入会话 Cookie
+func setSessionCookie(c *gin.Context, user *models.User) (string, error) {
+	token, err := auth.GenerateToken(user)
+	if err != nil {
+		return "", err
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(auth.TokenCookieName, token, int(auth.TokenTTL.Seconds()), "/", "", c.Request.TLS != nil, true)
+	return token, nil
+}
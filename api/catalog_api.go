@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"qlist/catalog"
+	"qlist/middleware"
+	"qlist/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StartCatalogSync godoc
+// @Summary 同步存储目录
+// @Description 在后台遍历当前站点的存储，新增、更新、重命名和软删除 files 表中的记录
+// @Tags Files
+// @Produce json
+// @Success 202 {object} catalog.Progress
+// @Router /api/files/sync [post]
+func StartCatalogSync(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	progress, err := catalog.Start(site)
+	if err != nil {
+		if err == catalog.ErrRunning {
+			response.RespondWithError(c, http.StatusConflict, err.Error())
+			return
+		}
+		response.RespondWithError(c, http.StatusInternalServerError, "启动目录同步失败")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusAccepted, progress)
+}
+
+// GetCatalogSyncStatus godoc
+// @Summary 查询目录同步进度
+// @Description 返回当前站点正在进行或最近一次完成的目录同步进度
+// @Tags Files
+// @Produce json
+// @Success 200 {object} catalog.Progress
+// @Router /api/files/sync [get]
+func GetCatalogSyncStatus(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	progress := catalog.Status(site.ID)
+	if progress == nil {
+		response.RespondWithError(c, http.StatusNotFound, "尚未同步过目录")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, progress)
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"qlist/config"
+	"qlist/db"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/response"
+	"qlist/pkg/signedurl"
+	"qlist/storage"
+	"qlist/throttle"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// defaultDownloadLinkTTL 下载链接的默认有效期
+const defaultDownloadLinkTTL = time.Hour
+
+// downloadLinkTTL 返回下载链接的有效期
+func downloadLinkTTL() time.Duration {
+	if config.Instance.DownloadLinkTTL > 0 {
+		return time.Duration(config.Instance.DownloadLinkTTL) * time.Second
+	}
+	return defaultDownloadLinkTTL
+}
+
+// ProxyDownload godoc
+// @Summary 通过下载链接读取文件
+// @Description 校验 /api/download 返回的限时签名链接后由服务端转发文件内容，支持 Range 断点续传。链接过期后需重新获取，每次实际传输的字节数计入下载流量配额
+// @Tags Files
+// @Produce octet-stream
+// @Param token path string true "下载令牌"
+// @Success 200 {file} binary
+// @Success 206 {file} binary
+// @Router /d/{token} [get]
+func ProxyDownload(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	claims, err := signedurl.Verify(c.Param("token"))
+	if err != nil {
+		if errors.Is(err, signedurl.ErrInvalid) || errors.Is(err, signedurl.ErrExpired) {
+			response.RespondWithError(c, http.StatusForbidden, err.Error())
+			return
+		}
+		response.RespondWithError(c, http.StatusInternalServerError, "校验下载链接失败")
+		return
+	}
+	if claims.SiteID != site.ID || isHiddenPath(claims.Path) {
+		response.RespondWithError(c, http.StatusForbidden, signedurl.ErrInvalid.Error())
+		return
+	}
+
+	// 文件被移动或删除后旧链接失效
+	var file models.File
+	if err := db.GetDB().Where("id = ? AND site_id = ? AND path = ?", claims.FileID, site.ID, claims.Path).First(&file).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.RespondWithError(c, http.StatusNotFound, "文件不存在")
+			return
+		}
+		response.RespondWithError(c, http.StatusInternalServerError, "查询文件失败")
+		return
+	}
+
+	var user models.User
+	if err := db.GetDB().Where("id = ? AND site_id = ?", claims.UserID, site.ID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.RespondWithError(c, http.StatusForbidden, signedurl.ErrInvalid.Error())
+			return
+		}
+		response.RespondWithError(c, http.StatusInternalServerError, "查询用户失败")
+		return
+	}
+
+	// 按用户和站点限速，HEAD 请求不传输内容，不占用连接数
+	var writer http.ResponseWriter = c.Writer
+	if c.Request.Method != http.MethodHead {
+		conn, err := throttle.Acquire(site.ID, user.ID, downloadLimit(&user), int64(config.Instance.Download.SiteRate)*1024)
+		if err != nil {
+			c.Header("Retry-After", "10")
+			response.RespondWithError(c, http.StatusTooManyRequests, err.Error())
+			return
+		}
+		defer conn.Release()
+		writer = conn.Writer(c.Request.Context(), c.Writer)
+	}
+
+	driver, err := middleware.GetStorageFromContext(c)
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "获取站点存储失败")
+		return
+	}
+	opener, ok := driver.(storage.Opener)
+	if !ok {
+		response.RespondWithError(c, http.StatusNotImplemented, "当前存储驱动不支持读取文件内容")
+		return
+	}
+	content, object, err := opener.Open(c.Request.Context(), claims.Path)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			response.RespondWithError(c, http.StatusNotFound, "文件不存在")
+			return
+		}
+		response.RespondWithError(c, http.StatusBadGateway, "读取文件失败")
+		return
+	}
+	defer content.Close()
+
+	// 流量按每次实际传输的字节数统计，重复使用同一链接同样计入，断点续传按请求的范围长度检查剩余流量
+	if c.Request.Method != http.MethodHead {
+		size := requestedLength(c.Request, object.Size, object.Modified)
+		if err := checkQuota(db.GetDB(), site, user.ID, false, size); err != nil {
+			respondQuotaError(c, err)
+			return
+		}
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": object.Name}))
+	c.Header("Cache-Control", "private, no-store")
+	// 令牌出现在地址中，不随跳转发送给其他站点
+	c.Header("Referrer-Policy", "no-referrer")
+	if file.ContentType != "" {
+		c.Header("Content-Type", file.ContentType)
+	}
+	counter := &countingWriter{ResponseWriter: writer}
+	http.ServeContent(counter, c.Request, object.Name, object.Modified, content)
+	if counter.written > 0 {
+		if err := recordDownload(site.ID, user.ID, &file, counter.written); err != nil {
+			log.Printf("记录下载流量失败: %v", err)
+		}
+	}
+}
+
+// requestedLength 按 http.ServeContent 的规则计算请求将要传输的字节数
+// 没有 Range、If-Range 不匹配或 Range 无法解析时传输整个文件，多个范围的长度相加，不超过文件大小
+func requestedLength(r *http.Request, size int64, modified time.Time) int64 {
+	header := r.Header.Get("Range")
+	if header == "" || !strings.HasPrefix(header, "bytes=") {
+		return size
+	}
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" {
+		t, err := http.ParseTime(ifRange)
+		if err != nil || modified.IsZero() || !modified.Truncate(time.Second).Equal(t) {
+			return size
+		}
+	}
+
+	var total int64
+	for _, spec := range strings.Split(strings.TrimPrefix(header, "bytes="), ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(spec, "-")
+		if !ok {
+			return size
+		}
+		start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+		if start == "" {
+			// 后缀范围 -n 表示最后 n 个字节
+			n, err := strconv.ParseInt(end, 10, 64)
+			if err != nil || n < 0 {
+				return size
+			}
+			total += min(n, size)
+			continue
+		}
+		first, err := strconv.ParseInt(start, 10, 64)
+		if err != nil || first < 0 {
+			return size
+		}
+		if first >= size {
+			// 超出文件末尾的范围不会传输
+			continue
+		}
+		last := size - 1
+		if end != "" {
+			if last, err = strconv.ParseInt(end, 10, 64); err != nil || last < first {
+				return size
+			}
+			last = min(last, size-1)
+		}
+		total += last - first + 1
+	}
+	return min(total, size)
+}
+
+// countingWriter 统计写入响应体的字节数，客户端中途断开时只计入已发送的部分
+type countingWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// downloadLimit 返回用户的下载限制，有效期内的会员按等级配置，否则使用普通用户的配置
+func downloadLimit(user *models.User) throttle.Limit {
+	limit := config.Instance.Download.DownloadLimit
+	if tier, ok := config.Instance.Download.Tiers[user.ActiveTier()]; ok {
+		limit = tier
+	}
+	return throttle.Limit{
+		Rate:        int64(limit.Rate) * 1024,
+		Connections: limit.Connections,
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"qlist/config"
+	"qlist/db"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/auth"
+	"qlist/storage"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// downloadTestEnv 下载并发测试的站点、用户和路由
+type downloadTestEnv struct {
+	router *gin.Engine
+	site   models.Site
+	user   models.User
+	token  string
+}
+
+// newDownloadTestEnv 使用临时 SQLite 数据库和本地存储创建站点及指定余额的用户，站点目录下有 files 个文件
+func newDownloadTestEnv(t *testing.T, price, balance, files int, quota models.DownloadQuota) *downloadTestEnv {
+	const domain = "example.com"
+
+	dir := t.TempDir()
+	config.Instance = config.AppConfig{
+		DBType:        "sqlite",
+		DBConn:        filepath.Join(dir, "qlist.db") + "?_busy_timeout=10000&_txlock=immediate",
+		JWTSecret:     "test-secret",
+		DefaultPoints: price,
+	}
+	if err := db.InitDB(); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+
+	root := filepath.Join(dir, "storage")
+	siteDir := filepath.Join(root, filepath.FromSlash(storage.SiteDir(domain)))
+	if err := os.MkdirAll(siteDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < files; i++ {
+		if err := os.WriteFile(filepath.Join(siteDir, fmt.Sprintf("file%d.bin", i)), []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	driver, err := storage.NewLocalDriver(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.SetDefault(driver)
+
+	env := &downloadTestEnv{site: models.Site{Name: "test", Domain: domain, Quota: quota}}
+	if err := db.GetDB().Create(&env.site).Error; err != nil {
+		t.Fatal(err)
+	}
+	env.user = models.User{SiteID: env.site.ID, Username: "u@example.com", Provider: "local", Points: balance}
+	if err := db.GetDB().Create(&env.user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if env.token, err = auth.GenerateToken(&env.user); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	env.router = gin.New()
+	env.router.Use(middleware.SiteMiddleware())
+	env.router.GET("/api/download", middleware.UserAuthMiddleware(), DownloadFile)
+	return env
+}
+
+// downloadAll 并发请求每个文件的下载链接，返回各响应状态码的次数
+func (env *downloadTestEnv) downloadAll(files int) map[int]int {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		statuses = map[int]int{}
+	)
+	for i := 0; i < files; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/download?path=/file%d.bin", i), nil)
+			req.Host = env.site.Domain
+			req.Header.Set("Authorization", "Bearer "+env.token)
+			w := httptest.NewRecorder()
+			env.router.ServeHTTP(w, req)
+			mu.Lock()
+			statuses[w.Code]++
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// charges 返回用户的扣费日志条数和当前余额
+func (env *downloadTestEnv) charges(t *testing.T) (int64, int) {
+	var updated models.User
+	if err := db.GetDB().First(&updated, env.user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var charges int64
+	if err := db.GetDB().Model(&models.PointLog{}).
+		Where("user_id = ? AND action = ? AND points < 0", env.user.ID, "file_access").
+		Count(&charges).Error; err != nil {
+		t.Fatal(err)
+	}
+	return charges, updated.Points
+}
+
+// TestConcurrentDownloadDeduction 并发下载多个付费文件，余额只够其中一部分时，
+// 积分不能扣成负数，扣费日志条数与成功的下载数一致
+func TestConcurrentDownloadDeduction(t *testing.T) {
+	const (
+		price    = 3
+		balance  = 10
+		requests = 12
+	)
+	affordable := balance / price
+
+	env := newDownloadTestEnv(t, price, balance, requests, models.DownloadQuota{})
+	statuses := env.downloadAll(requests)
+	charges, points := env.charges(t)
+
+	if points < 0 {
+		t.Fatalf("积分被扣成负数: %d", points)
+	}
+	if statuses[http.StatusOK] != affordable || charges != int64(affordable) {
+		t.Fatalf("成功下载 %d 次、扣费 %d 次，期望均为 %d，响应状态: %v", statuses[http.StatusOK], charges, affordable, statuses)
+	}
+	if points != balance-affordable*price {
+		t.Fatalf("剩余积分 %d，期望 %d", points, balance-affordable*price)
+	}
+	if statuses[http.StatusOK]+statuses[http.StatusForbidden] != requests {
+		t.Fatalf("存在积分不足以外的失败，响应状态: %v", statuses)
+	}
+}
+
+// TestConcurrentDownloadQuota 并发下载多个付费文件，余额充足但付费下载次数有限时，
+// 扣费次数不能超过每日付费下载次数
+func TestConcurrentDownloadQuota(t *testing.T) {
+	const (
+		price    = 1
+		limit    = 2
+		requests = 10
+	)
+
+	env := newDownloadTestEnv(t, price, 100, requests, models.DownloadQuota{DailyDownloads: limit})
+	statuses := env.downloadAll(requests)
+	charges, points := env.charges(t)
+
+	if statuses[http.StatusOK] != limit || charges != limit {
+		t.Fatalf("成功下载 %d 次、扣费 %d 次，期望均为 %d，响应状态: %v", statuses[http.StatusOK], charges, limit, statuses)
+	}
+	if points != 100-limit*price {
+		t.Fatalf("剩余积分 %d，期望 %d", points, 100-limit*price)
+	}
+	if statuses[http.StatusTooManyRequests] != requests-limit {
+		t.Fatalf("超出配额的请求应返回 429，响应状态: %v", statuses)
+	}
+}
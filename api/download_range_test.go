@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRequestedLength Range 请求按请求的范围长度计入流量，无法按范围传输时按整个文件计算
+func TestRequestedLength(t *testing.T) {
+	const size = 1000
+	modified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		rangeH  string
+		ifRange string
+		want    int64
+	}{
+		{name: "没有 Range", want: size},
+		{name: "闭区间", rangeH: "bytes=0-99", want: 100},
+		{name: "从指定位置到末尾", rangeH: "bytes=900-", want: 100},
+		{name: "最后 n 个字节", rangeH: "bytes=-10", want: 10},
+		{name: "后缀超过文件大小", rangeH: "bytes=-5000", want: size},
+		{name: "结束位置超过文件末尾", rangeH: "bytes=990-5000", want: 10},
+		{name: "多个范围相加", rangeH: "bytes=0-9, 100-109,-5", want: 25},
+		{name: "多个范围合计超过文件大小", rangeH: "bytes=0-999,0-999", want: size},
+		{name: "起始位置超过文件末尾", rangeH: "bytes=1000-", want: 0},
+		{name: "无法解析", rangeH: "bytes=a-b", want: size},
+		{name: "结束位置小于起始位置", rangeH: "bytes=10-5", want: size},
+		{name: "不支持的单位", rangeH: "items=0-1", want: size},
+		{name: "If-Range 匹配", rangeH: "bytes=0-99", ifRange: modified.Format(http.TimeFormat), want: 100},
+		{name: "If-Range 不匹配", rangeH: "bytes=0-99", ifRange: modified.Add(time.Hour).Format(http.TimeFormat), want: size},
+		{name: "If-Range 为 ETag", rangeH: "bytes=0-99", ifRange: `"abc"`, want: size},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/download/proxy", nil)
+			if tt.rangeH != "" {
+				req.Header.Set("Range", tt.rangeH)
+			}
+			if tt.ifRange != "" {
+				req.Header.Set("If-Range", tt.ifRange)
+			}
+			if got := requestedLength(req, size, modified); got != tt.want {
+				t.Fatalf("Range %q 计入 %d 字节，期望 %d", tt.rangeH, got, tt.want)
+			}
+		})
+	}
+}
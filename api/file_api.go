@@ -2,10 +2,12 @@ package api
 
 import (
 	"net/http"
+	"path"
 	"qlist/db"
 	"qlist/middleware"
 	"qlist/models"
 	"qlist/pkg/response"
+	"qlist/pricing"
 	"strconv"
 	"time"
 
@@ -13,6 +15,37 @@ import (
 	"gorm.io/gorm"
 )
 
+// recentVisibleFiles 按上传时间倒序分批查询站点文件，跳过隐藏路径下的文件，直到凑满一页或没有更多文件
+// 隐藏规则是通配符，无法在 SQL 中过滤，offset 按可见文件计算
+func recentVisibleFiles(siteID uint, limit, offset int) ([]models.File, error) {
+	const batchSize = 100
+
+	files := make([]models.File, 0, limit)
+	skipped := 0
+	for scanned := 0; ; scanned += batchSize {
+		var batch []models.File
+		if err := db.GetDB().Where("site_id = ?", siteID).Order("uploaded_at DESC, id DESC").Limit(batchSize).Offset(scanned).Find(&batch).Error; err != nil {
+			return nil, err
+		}
+		for _, file := range batch {
+			if isHiddenPath(file.Path) {
+				continue
+			}
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			files = append(files, file)
+			if len(files) == limit {
+				return files, nil
+			}
+		}
+		if len(batch) < batchSize {
+			return files, nil
+		}
+	}
+}
+
 // GetRecentFiles godoc
 // @Summary 获取最近上传的文件
 // @Description 获取站点最近上传的文件列表
@@ -45,41 +78,99 @@ func GetRecentFiles(c *gin.Context) {
 	}
 
 	// 查询最近上传的文件
-	var files []models.File
-	if err := db.GetDB().Where("site_id = ?", site.ID).Order("uploaded_at DESC").Limit(limit).Offset(offset).Find(&files).Error; err != nil {
+	files, err := recentVisibleFiles(site.ID, limit, offset)
+	if err != nil {
 		response.RespondWithError(c, http.StatusInternalServerError, "查询文件列表失败")
 		return
 	}
 
 	// 获取每个文件的积分配置
+	resolver, err := pricing.NewResolver(site.ID)
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "查询定价规则失败")
+		return
+	}
 	for i := range files {
-		var config models.PointConfig
-		if err := db.GetDB().Where("site_id = ? AND path = ?", site.ID, files[i].Path).First(&config).Error; err != nil {
-			if err != gorm.ErrRecordNotFound {
-				// 只记录非"未找到"的错误
-				files[i].PointConfig = models.PointConfig{Points: 0}
-			}
-		} else {
-			files[i].PointConfig = config
+		price, err := resolver.ResolveFile(&files[i])
+		if err != nil {
+			response.RespondWithError(c, http.StatusInternalServerError, "查询文件积分配置失败")
+			return
 		}
+		files[i].PointConfig = models.PointConfig{
+			FileID:      &files[i].ID,
+			Path:        price.Path,
+			Points:      price.Points,
+			Description: price.Description,
+		}
+		files[i].PointConfig.ID = price.ConfigID
 	}
 
 	response.RespondWithJSON(c, http.StatusOK, files)
 }
 
 // RecordFileUpload 记录文件上传信息
-// 此函数在文件上传成功后调用，用于记录文件信息
-func RecordFileUpload(siteID uint, path string, name string, size int64, contentType string) error {
-	file := models.File{
-		SiteID:      siteID,
-		Path:        path,
-		Name:        name,
-		Size:        size,
-		ContentType: contentType,
-		UploadedAt:  time.Now(),
+// 此函数在文件上传成功后调用，同一路径重复上传时更新原记录，保留下载次数和积分配置
+func RecordFileUpload(siteID uint, filePath string, name string, size int64, contentType string) (*models.File, error) {
+	filePath = pricing.NormalizePath(filePath)
+	now := time.Now()
+
+	var file models.File
+	err := db.GetDB().Unscoped().Where("site_id = ? AND path = ?", siteID, filePath).Order("id").First(&file).Error
+	if err == gorm.ErrRecordNotFound {
+		file = models.File{
+			SiteID:      siteID,
+			Path:        filePath,
+			Name:        name,
+			Size:        size,
+			ContentType: contentType,
+			UploadedAt:  now,
+			ModifiedAt:  &now,
+		}
+		if err := db.GetDB().Create(&file).Error; err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		if err := db.GetDB().Unscoped().Model(&file).Updates(map[string]interface{}{
+			"name":         name,
+			"size":         size,
+			"content_type": contentType,
+			"uploaded_at":  now,
+			"modified_at":  now,
+			"deleted_at":   gorm.DeletedAt{},
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := linkPointConfig(siteID, file.Path, file.ID); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// ensureFile 返回路径对应的文件记录，尚未入库的文件会自动登记
+func ensureFile(siteID uint, filePath string) (*models.File, error) {
+	filePath = pricing.NormalizePath(filePath)
+	file := models.File{}
+	err := db.GetDB().Where("site_id = ? AND path = ?", siteID, filePath).
+		Attrs(models.File{SiteID: siteID, Path: filePath, Name: path.Base(filePath), UploadedAt: time.Now()}).
+		FirstOrCreate(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := linkPointConfig(siteID, filePath, file.ID); err != nil {
+		return nil, err
 	}
+	return &file, nil
+}
 
-	return db.GetDB().Create(&file).Error
+// linkPointConfig 文件入库后，将按路径预先配置的积分关联到文件
+func linkPointConfig(siteID uint, filePath string, fileID uint) error {
+	return db.GetDB().Model(&models.PointConfig{}).
+		Where("site_id = ? AND path = ? AND file_id IS NULL", siteID, filePath).
+		Update("file_id", fileID).Error
 }
 
 // UpdateFileDownloadCount 更新文件下载次数
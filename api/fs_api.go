@@ -0,0 +1,254 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"qlist/config"
+	"qlist/db"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/response"
+	"qlist/pricing"
+	"qlist/storage"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FsEntry 目录列表中的文件或子目录，价格、下载次数和是否已购买只对文件有效
+type FsEntry struct {
+	Name        string    `json:"name"`
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	IsDir       bool      `json:"isDir"`
+	Modified    time.Time `json:"modified"`
+	FileID      uint      `json:"fileId,omitempty"`
+	Points      int       `json:"points"`
+	PriceSource string    `json:"priceSource,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Downloads   int       `json:"downloads"`
+	Owned       bool      `json:"owned"`
+}
+
+// FsListResponse 目录列表的分页结果
+type FsListResponse struct {
+	Path     string    `json:"path"`
+	Total    int       `json:"total"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"pageSize"`
+	Items    []FsEntry `json:"items"`
+}
+
+// ListDirectory godoc
+// @Summary 浏览目录
+// @Description 列出存储中的目录内容，并合并文件价格、下载次数和当前用户是否已购买。目录始终排在文件前面，隐藏路径不会返回
+// @Tags Files
+// @Produce json
+// @Param path query string false "目录路径，默认为 /"
+// @Param page query int false "页码，从 1 开始"
+// @Param page_size query int false "每页数量，默认 50，最大 200"
+// @Param sort query string false "排序字段 name / size / modified / downloads"
+// @Param order query string false "排序方向 asc / desc"
+// @Success 200 {object} FsListResponse
+// @Router /api/fs/list [get]
+func ListDirectory(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	dirPath := pricing.NormalizePath(c.DefaultQuery("path", "/"))
+	if isHiddenPath(dirPath) {
+		response.RespondWithError(c, http.StatusNotFound, "目录不存在")
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if err != nil || pageSize <= 0 || pageSize > 200 {
+		pageSize = 50
+	}
+
+	driver, err := middleware.GetStorageFromContext(c)
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "获取站点存储失败")
+		return
+	}
+	objects, err := driver.List(c.Request.Context(), dirPath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			response.RespondWithError(c, http.StatusNotFound, "目录不存在")
+			return
+		}
+		response.RespondWithError(c, http.StatusInternalServerError, "获取目录列表失败")
+		return
+	}
+
+	entries := make([]FsEntry, 0, len(objects))
+	var filePaths []string
+	for _, object := range objects {
+		if isHiddenPath(object.Path) {
+			continue
+		}
+		entries = append(entries, FsEntry{
+			Name:     object.Name,
+			Path:     object.Path,
+			Size:     object.Size,
+			IsDir:    object.IsDir,
+			Modified: object.Modified,
+		})
+		if !object.IsDir {
+			filePaths = append(filePaths, object.Path)
+		}
+	}
+
+	// 合并已入库文件的下载次数
+	files := make(map[string]*models.File, len(filePaths))
+	if len(filePaths) > 0 {
+		var rows []models.File
+		if err := db.GetDB().Where("site_id = ? AND path IN ?", site.ID, filePaths).Find(&rows).Error; err != nil {
+			response.RespondWithError(c, http.StatusInternalServerError, "查询文件列表失败")
+			return
+		}
+		for i := range rows {
+			files[rows[i].Path] = &rows[i]
+		}
+	}
+	for i := range entries {
+		if file, ok := files[entries[i].Path]; ok {
+			entries[i].FileID = file.ID
+			entries[i].Downloads = file.Downloads
+		}
+	}
+
+	sortEntries(entries, c.DefaultQuery("sort", "name"), c.DefaultQuery("order", "asc") == "desc")
+
+	total := len(entries)
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	items := entries[start:end]
+
+	// 只为当前页的文件计算价格
+	resolver, err := pricing.NewResolver(site.ID)
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "查询定价规则失败")
+		return
+	}
+	var fileIDs []uint
+	for i := range items {
+		if items[i].IsDir {
+			continue
+		}
+		var price *pricing.Price
+		if file, ok := files[items[i].Path]; ok {
+			price, err = resolver.ResolveFile(file)
+			fileIDs = append(fileIDs, file.ID)
+		} else {
+			price, err = resolver.Resolve(items[i].Path)
+		}
+		if err != nil {
+			response.RespondWithError(c, http.StatusInternalServerError, "查询文件积分配置失败")
+			return
+		}
+		items[i].Points = price.Points
+		items[i].PriceSource = price.Source
+		items[i].Description = price.Description
+	}
+
+	// 登录用户标记有效期内已购买的文件
+	if user, ok := middleware.GetUserFromContext(c); ok && len(fileIDs) > 0 {
+		var owned []uint
+		if err := db.GetDB().Model(&models.Purchase{}).
+			Where("user_id = ? AND site_id = ? AND file_id IN ?", user.ID, site.ID, fileIDs).
+			Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+			Pluck("file_id", &owned).Error; err != nil {
+			response.RespondWithError(c, http.StatusInternalServerError, "查询购买记录失败")
+			return
+		}
+		ownedSet := make(map[uint]bool, len(owned))
+		for _, id := range owned {
+			ownedSet[id] = true
+		}
+		for i := range items {
+			items[i].Owned = items[i].FileID != 0 && ownedSet[items[i].FileID]
+		}
+	}
+
+	response.RespondWithJSON(c, http.StatusOK, FsListResponse{
+		Path:     dirPath,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+		Items:    items,
+	})
+}
+
+// sortEntries 按指定字段排序，目录始终排在文件前面，相同时按名称排序
+func sortEntries(entries []FsEntry, field string, desc bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+
+		var cmp int
+		switch field {
+		case "size":
+			cmp = compareInt64(a.Size, b.Size)
+		case "modified":
+			cmp = a.Modified.Compare(b.Modified)
+		case "downloads":
+			cmp = compareInt64(int64(a.Downloads), int64(b.Downloads))
+		}
+		if cmp == 0 {
+			cmp = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// isHiddenPath 判断路径是否不对外展示：以 . 开头的文件或目录，以及配置的隐藏路径
+func isHiddenPath(filePath string) bool {
+	for _, name := range strings.Split(filePath, "/") {
+		if strings.HasPrefix(name, ".") {
+			return true
+		}
+	}
+	for _, pattern := range config.Instance.HiddenPaths {
+		pattern, err := pricing.NormalizePattern(pattern)
+		if err != nil {
+			continue
+		}
+		if pricing.Match(pattern, filePath) {
+			return true
+		}
+	}
+	return false
+}
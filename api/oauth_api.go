@@ -0,0 +1,484 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"qlist/config"
+	"qlist/db"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/oauth"
+	"qlist/pkg/response"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	oauthStateCookie    = "qlist_oauth_state"
+	oauthRedirectCookie = "qlist_oauth_redirect"
+	oauthLinkCookie     = "qlist_oauth_link"
+	oauthCookieMaxAge   = 600
+)
+
+// errOAuthIdentityTaken 三方账号已作为独立账号登录过，或已关联到其他本地账号
+var errOAuthIdentityTaken = errors.New("该三方账号已被其他账号使用")
+
+// GetLoginOptions godoc
+// @Summary 获取登录方式
+// @Description 返回当前站点可用的登录方式，未配置的三方登录不会出现在列表中
+// @Tags Auth
+// @Produce json
+// @Success 200 {array} map[string]string
+// @Router /api/login/options [get]
+func GetLoginOptions(c *gin.Context) {
+	response.RespondWithJSON(c, http.StatusOK, middleware.LoginOptions())
+}
+
+// GoogleLoginStart godoc
+// @Summary Google 登录
+// @Description 跳转到 Google 授权页面
+// @Tags Auth
+// @Param redirect_after_login query string false "登录成功后跳转的地址"
+// @Param link query string false "为 1 时将三方账号关联到当前登录的本地账号"
+// @Success 302
+// @Router /api/oauth/google/start [get]
+func GoogleLoginStart(c *gin.Context) {
+	if !oauth.GoogleEnabled() {
+		response.RespondWithError(c, http.StatusNotFound, "未启用 Google 登录")
+		return
+	}
+
+	state, ok := beginOAuth(c, "google")
+	if !ok {
+		return
+	}
+	redirectURI := oauthRedirectURI(c, "google", config.Instance.GoogleOAuth.RedirectURI)
+	c.Redirect(http.StatusFound, oauth.GoogleAuthCodeURL(state, redirectURI))
+}
+
+// GoogleLoginCallback godoc
+// @Summary Google 登录回调
+// @Description 使用授权码完成 Google 登录，查找或创建当前站点的用户并签发登录态
+// @Tags Auth
+// @Param code query string true "授权码"
+// @Param state query string true "state"
+// @Success 302
+// @Router /api/oauth/google/callback [get]
+func GoogleLoginCallback(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+	if !oauth.GoogleEnabled() {
+		response.RespondWithError(c, http.StatusNotFound, "未启用 Google 登录")
+		return
+	}
+	if !verifyOAuthState(c, "google") {
+		response.RespondWithError(c, http.StatusBadRequest, "登录状态校验失败，请重新登录")
+		return
+	}
+	linkTo, ok := oauthLinkTarget(c)
+	if !ok {
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		response.RespondWithError(c, http.StatusBadRequest, "缺少授权码")
+		return
+	}
+
+	redirectURI := oauthRedirectURI(c, "google", config.Instance.GoogleOAuth.RedirectURI)
+	profile, err := oauth.GoogleExchange(code, redirectURI)
+	if err != nil {
+		response.RespondWithError(c, http.StatusBadGateway, "Google 登录失败")
+		return
+	}
+
+	completeOAuth(c, site, profile, linkTo)
+}
+
+// GitHubLoginStart godoc
+// @Summary GitHub 登录
+// @Description 跳转到 GitHub 授权页面
+// @Tags Auth
+// @Param redirect_after_login query string false "登录成功后跳转的地址"
+// @Param link query string false "为 1 时将三方账号关联到当前登录的本地账号"
+// @Success 302
+// @Router /api/oauth/github/start [get]
+func GitHubLoginStart(c *gin.Context) {
+	if !oauth.GitHubEnabled() {
+		response.RespondWithError(c, http.StatusNotFound, "未启用 GitHub 登录")
+		return
+	}
+
+	state, ok := beginOAuth(c, "github")
+	if !ok {
+		return
+	}
+	redirectURI := oauthRedirectURI(c, "github", config.Instance.GitHubOAuth.RedirectURI)
+	c.Redirect(http.StatusFound, oauth.GitHubAuthCodeURL(state, redirectURI))
+}
+
+// GitHubLoginCallback godoc
+// @Summary GitHub 登录回调
+// @Description 使用授权码完成 GitHub 登录，按 GitHub 用户 id 查找或创建用户，关联模式下将其关联到当前登录的本地账号
+// @Tags Auth
+// @Param code query string true "授权码"
+// @Param state query string true "state"
+// @Success 302
+// @Router /api/oauth/github/callback [get]
+func GitHubLoginCallback(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+	if !oauth.GitHubEnabled() {
+		response.RespondWithError(c, http.StatusNotFound, "未启用 GitHub 登录")
+		return
+	}
+	if !verifyOAuthState(c, "github") {
+		response.RespondWithError(c, http.StatusBadRequest, "登录状态校验失败，请重新登录")
+		return
+	}
+	linkTo, ok := oauthLinkTarget(c)
+	if !ok {
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		response.RespondWithError(c, http.StatusBadRequest, "缺少授权码")
+		return
+	}
+
+	redirectURI := oauthRedirectURI(c, "github", config.Instance.GitHubOAuth.RedirectURI)
+	profile, err := oauth.GitHubExchange(code, redirectURI)
+	if err != nil {
+		response.RespondWithError(c, http.StatusBadGateway, "GitHub 登录失败")
+		return
+	}
+
+	completeOAuth(c, site, profile, linkTo)
+}
+
+// WechatLoginStart godoc
+// @Summary 微信扫码登录
+// @Description 跳转到微信开放平台扫码登录页面
+// @Tags Auth
+// @Param redirect_after_login query string false "登录成功后跳转的地址"
+// @Param link query string false "为 1 时将三方账号关联到当前登录的本地账号"
+// @Success 302
+// @Router /api/oauth/wechat/start [get]
+func WechatLoginStart(c *gin.Context) {
+	if !oauth.WechatEnabled() {
+		response.RespondWithError(c, http.StatusNotFound, "未启用微信登录")
+		return
+	}
+
+	state, ok := beginOAuth(c, "wechat")
+	if !ok {
+		return
+	}
+	redirectURI := oauthRedirectURI(c, "wechat", config.Instance.WechatOAuth.RedirectURI)
+	c.Redirect(http.StatusFound, oauth.WechatAuthCodeURL(state, redirectURI))
+}
+
+// WechatLoginCallback godoc
+// @Summary 微信扫码登录回调
+// @Description 使用授权码完成微信登录，按 unionid 或 openid 查找或创建当前站点的用户并签发登录态
+// @Tags Auth
+// @Param code query string true "授权码，用户拒绝授权时为空"
+// @Param state query string true "state"
+// @Success 302
+// @Router /api/oauth/wechat/callback [get]
+func WechatLoginCallback(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+	if !oauth.WechatEnabled() {
+		response.RespondWithError(c, http.StatusNotFound, "未启用微信登录")
+		return
+	}
+	if !verifyOAuthState(c, "wechat") {
+		response.RespondWithError(c, http.StatusBadRequest, "登录状态校验失败，请重新登录")
+		return
+	}
+	linkTo, ok := oauthLinkTarget(c)
+	if !ok {
+		return
+	}
+
+	// 用户在手机上拒绝授权时，微信只回传 state 不带 code
+	code := c.Query("code")
+	if code == "" {
+		response.RespondWithError(c, http.StatusBadRequest, "用户取消了微信授权")
+		return
+	}
+
+	profile, err := oauth.WechatExchange(code)
+	if err != nil {
+		response.RespondWithError(c, http.StatusBadGateway, "微信登录失败")
+		return
+	}
+
+	completeOAuth(c, site, profile, linkTo)
+}
+
+// beginOAuth 生成 state 并将其与登录后的跳转地址写入 Cookie，失败时已写入响应
+// 请求带 link=1 时须已登录本地账号，回调时将三方账号关联到该账号
+func beginOAuth(c *gin.Context, provider string) (string, bool) {
+	secure := c.Request.TLS != nil
+	c.SetSameSite(http.SameSiteLaxMode)
+	if c.Query("link") == "1" {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists || user.Provider != "local" {
+			response.RespondWithError(c, http.StatusUnauthorized, "请先登录要关联的本地账号")
+			return "", false
+		}
+		c.SetCookie(oauthLinkCookie, strconv.FormatUint(uint64(user.ID), 10), oauthCookieMaxAge, "/api/oauth", "", secure, true)
+	} else {
+		c.SetCookie(oauthLinkCookie, "", -1, "/api/oauth", "", secure, true)
+	}
+
+	state, err := oauth.GenerateState()
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "生成登录状态失败")
+		return "", false
+	}
+	c.SetCookie(oauthStateCookie, provider+":"+state, oauthCookieMaxAge, "/api/oauth", "", secure, true)
+
+	target := c.Query("redirect_after_login")
+	if target == "" {
+		target = c.Query("redirect_url")
+	}
+	if target = safeRedirect(c, target); target != "" {
+		c.SetCookie(oauthRedirectCookie, target, oauthCookieMaxAge, "/api/oauth", "", secure, true)
+	}
+	return state, true
+}
+
+// oauthLinkTarget 返回本次授权要关联的本地账号，非关联模式返回 nil，失败时已写入响应
+// 发起关联与完成回调时必须是同一个已登录的本地账号
+func oauthLinkTarget(c *gin.Context) (*models.User, bool) {
+	linkID, err := c.Cookie(oauthLinkCookie)
+	c.SetCookie(oauthLinkCookie, "", -1, "/api/oauth", "", c.Request.TLS != nil, true)
+	if err != nil || linkID == "" {
+		return nil, true
+	}
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists || user.Provider != "local" || strconv.FormatUint(uint64(user.ID), 10) != linkID {
+		response.RespondWithError(c, http.StatusUnauthorized, "登录状态已变化，请重新登录本地账号后再关联")
+		return nil, false
+	}
+	return user, true
+}
+
+// verifyOAuthState 校验回调中的 state 与 Cookie 中保存的一致，校验后立即失效
+func verifyOAuthState(c *gin.Context, provider string) bool {
+	expected, err := c.Cookie(oauthStateCookie)
+	c.SetCookie(oauthStateCookie, "", -1, "/api/oauth", "", c.Request.TLS != nil, true)
+	if err != nil || expected == "" {
+		return false
+	}
+	actual := provider + ":" + c.Query("state")
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) == 1
+}
+
+// completeOAuth 完成三方登录或关联，失败时已写入响应
+// 首次登录的三方账号提供了已验证的邮箱且与本地账号相同时，不直接登录，由用户确认后关联或另建账号
+func completeOAuth(c *gin.Context, site *models.Site, profile *oauth.Profile, linkTo *models.User) {
+	if linkTo == nil {
+		local, err := oauthLinkCandidate(site.ID, profile)
+		if err != nil {
+			response.RespondWithError(c, http.StatusInternalServerError, "查询用户失败")
+			return
+		}
+		if local != nil {
+			startPendingOAuthLink(c, site.ID, profile)
+			return
+		}
+	}
+
+	user, err := findOrCreateOAuthUser(site.ID, profile, linkTo)
+	if err != nil {
+		respondOAuthUserError(c, err)
+		return
+	}
+	finishOAuthLogin(c, user)
+}
+
+// finishOAuthLogin 签发登录态并跳转回登录前的页面
+func finishOAuthLogin(c *gin.Context, user *models.User) {
+	if _, err := setSessionCookie(c, user); err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "签发登录令牌失败")
+		return
+	}
+	c.Redirect(http.StatusFound, oauthRedirectTarget(c))
+}
+
+// oauthRedirectTarget 返回发起登录时保存的跳转地址，未保存时为首页，读取后清除
+func oauthRedirectTarget(c *gin.Context) string {
+	target := "/"
+	if saved, err := c.Cookie(oauthRedirectCookie); err == nil {
+		if saved = safeRedirect(c, saved); saved != "" {
+			target = saved
+		}
+	}
+	c.SetCookie(oauthRedirectCookie, "", -1, "/api/oauth", "", c.Request.TLS != nil, true)
+	return target
+}
+
+// findOrCreateOAuthUser 按渠道用户标识查找当前站点的用户，不存在则创建
+// 三方账号只在用户登录本地账号后主动发起关联（linkTo 不为 nil），或在已验证邮箱匹配后经本地账号密码确认时才会关联，
+// 不按邮箱自动关联：本地注册的邮箱未经验证，自动关联会让他人抢先注册受害者的邮箱来接管其三方登录
+func findOrCreateOAuthUser(siteID uint, profile *oauth.Profile, linkTo *models.User) (*models.User, error) {
+	var user models.User
+	err := findOAuthUser(siteID, profile, &user)
+	if err == gorm.ErrRecordNotFound {
+		user = models.User{
+			SiteID:        siteID,
+			Username:      profile.Subject,
+			Provider:      profile.Provider,
+			Email:         profile.Email,
+			Nickname:      profile.Nickname,
+			Avatar:        profile.Avatar,
+			WechatOpenID:  profile.OpenID,
+			WechatUnionID: profile.UnionID,
+		}
+		if linkTo != nil {
+			user.LinkedID = linkTo.ID
+		}
+
+		if err := db.GetDB().Create(&user).Error; err != nil {
+			return nil, err
+		}
+		return resolveLinkedUser(&user)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 已登录过的三方账号有自己的积分和购买记录，不再合并到其他账号
+	if linkTo != nil && user.LinkedID != linkTo.ID {
+		return nil, errOAuthIdentityTaken
+	}
+
+	// 同步渠道侧最新的资料
+	updates := map[string]interface{}{}
+	if profile.Email != "" && profile.Email != user.Email {
+		updates["email"] = profile.Email
+	}
+	if profile.Nickname != "" && profile.Nickname != user.Nickname {
+		updates["nickname"] = profile.Nickname
+	}
+	if profile.Avatar != "" && profile.Avatar != user.Avatar {
+		updates["avatar"] = profile.Avatar
+	}
+	// 补全旧记录和后来绑定开放平台的应用缺少的标识
+	if profile.OpenID != "" && user.WechatOpenID == "" {
+		updates["wechat_open_id"] = profile.OpenID
+	}
+	if profile.UnionID != "" && user.WechatUnionID == "" {
+		updates["wechat_union_id"] = profile.UnionID
+	}
+	if len(updates) > 0 {
+		if err := db.GetDB().Model(&user).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return resolveLinkedUser(&user)
+}
+
+// findOAuthUser 查找渠道用户标识对应的用户，不存在时返回 gorm.ErrRecordNotFound
+// 微信用户先按 unionid、再按 openid 匹配各自的字段，两者不共用用户名的取值范围；
+// 未记录这两个字段的旧用户按用户名匹配，登录后补全
+func findOAuthUser(siteID uint, profile *oauth.Profile, user *models.User) error {
+	query := db.GetDB().Where("site_id = ? AND provider = ?", siteID, profile.Provider)
+	if profile.Provider != "wechat" {
+		return query.Where("username = ?", profile.Subject).First(user).Error
+	}
+
+	if profile.UnionID != "" {
+		err := query.Session(&gorm.Session{}).Where("wechat_union_id = ?", profile.UnionID).First(user).Error
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+	}
+	err := query.Session(&gorm.Session{}).Where("wechat_open_id = ?", profile.OpenID).First(user).Error
+	if err != gorm.ErrRecordNotFound {
+		if err == nil && profile.UnionID != "" && user.WechatUnionID != "" && user.WechatUnionID != profile.UnionID {
+			return errOAuthIdentityTaken
+		}
+		return err
+	}
+	return query.Session(&gorm.Session{}).Where("username IN ? AND wechat_open_id = '' AND wechat_union_id = ''", []string{profile.UnionID, profile.OpenID}).
+		Order("id").First(user).Error
+}
+
+// respondOAuthUserError 将查找或创建三方登录用户的错误转换为响应
+func respondOAuthUserError(c *gin.Context, err error) {
+	if errors.Is(err, errOAuthIdentityTaken) {
+		response.RespondWithError(c, http.StatusConflict, err.Error())
+		return
+	}
+	response.RespondWithError(c, http.StatusInternalServerError, "创建用户失败")
+}
+
+// resolveLinkedUser 返回三方账号实际登录的用户，已关联本地账号时返回本地账号
+func resolveLinkedUser(user *models.User) (*models.User, error) {
+	if user.LinkedID == 0 {
+		return user, nil
+	}
+	var linked models.User
+	if err := db.GetDB().Where("id = ? AND site_id = ?", user.LinkedID, user.SiteID).First(&linked).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return user, nil
+		}
+		return nil, err
+	}
+	return &linked, nil
+}
+
+// oauthRedirectURI 返回回调地址，未配置时根据当前请求推导
+func oauthRedirectURI(c *gin.Context, provider, configured string) string {
+	if configured != "" {
+		return configured
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/api/oauth/" + provider + "/callback"
+}
+
+// safeRedirect 只允许跳转到本站地址，防止开放重定向
+func safeRedirect(c *gin.Context, target string) string {
+	if target == "" {
+		return ""
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	if u.IsAbs() || u.Host != "" {
+		if u.Host != c.Request.Host {
+			return ""
+		}
+		u.Scheme = ""
+		u.Host = ""
+	}
+	result := u.String()
+	if !strings.HasPrefix(result, "/") || strings.HasPrefix(result, "//") {
+		return ""
+	}
+	return result
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"qlist/db"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/oauth"
+	"qlist/pkg/response"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	oauthPendingCookie = "qlist_oauth_pending"
+	// oauthPendingAttempts 确认关联时允许输错密码的次数，超过后需重新登录三方账号
+	oauthPendingAttempts = 5
+)
+
+// pendingOAuthLink 等待用户确认的三方账号关联
+type pendingOAuthLink struct {
+	siteID    uint
+	profile   oauth.Profile
+	attempts  int
+	expiresAt time.Time
+}
+
+var (
+	pendingMu sync.Mutex
+	// pendingLinks 按 Cookie 中的随机令牌保存的待确认关联
+	pendingLinks = map[string]*pendingOAuthLink{}
+)
+
+// PendingOAuthLinkResponse 待确认关联的三方账号信息
+type PendingOAuthLinkResponse struct {
+	Provider string `json:"provider"`
+	Email    string `json:"email"`
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
+}
+
+// ConfirmOAuthLinkRequest 定义确认关联的请求体，已登录该邮箱的本地账号时可不填密码
+type ConfirmOAuthLinkRequest struct {
+	Password string `json:"password"`
+}
+
+// GetPendingOAuthLink godoc
+// @Summary 查询待确认的三方账号关联
+// @Description 三方账号首次登录且已验证的邮箱与本地账号相同时，回调会跳转到登录前的页面并带上 oauth_link=pending，前端据此展示确认页
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} PendingOAuthLinkResponse
+// @Router /api/oauth/pending [get]
+func GetPendingOAuthLink(c *gin.Context) {
+	_, link, ok := loadPendingOAuthLink(c)
+	if !ok {
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, PendingOAuthLinkResponse{
+		Provider: link.profile.Provider,
+		Email:    link.profile.Email,
+		Nickname: link.profile.Nickname,
+		Avatar:   link.profile.Avatar,
+	})
+}
+
+// ConfirmOAuthLink godoc
+// @Summary 确认关联三方账号
+// @Description 输入同邮箱本地账号的密码（或已登录该本地账号）确认后，将三方账号关联到本地账号并登录
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param confirm body ConfirmOAuthLinkRequest true "本地账号密码"
+// @Success 200 {object} LoginResponse
+// @Router /api/oauth/pending/confirm [post]
+func ConfirmOAuthLink(c *gin.Context) {
+	token, link, ok := loadPendingOAuthLink(c)
+	if !ok {
+		return
+	}
+
+	var req ConfirmOAuthLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+
+	local, err := oauthLinkCandidate(link.siteID, &link.profile)
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "查询用户失败")
+		return
+	}
+	if local == nil {
+		dropPendingOAuthLink(c, token)
+		response.RespondWithError(c, http.StatusConflict, "本地账号已不存在或三方账号已登录过，请重新登录")
+		return
+	}
+
+	current, loggedIn := middleware.GetUserFromContext(c)
+	if !loggedIn || current.ID != local.ID {
+		if bcrypt.CompareHashAndPassword([]byte(local.Password), []byte(req.Password)) != nil {
+			pendingMu.Lock()
+			link.attempts++
+			exhausted := link.attempts >= oauthPendingAttempts
+			pendingMu.Unlock()
+			if exhausted {
+				dropPendingOAuthLink(c, token)
+			}
+			response.RespondWithError(c, http.StatusUnauthorized, "密码错误")
+			return
+		}
+	}
+
+	dropPendingOAuthLink(c, token)
+	user, err := findOrCreateOAuthUser(link.siteID, &link.profile, local)
+	if err != nil {
+		respondOAuthUserError(c, err)
+		return
+	}
+	issueSession(c, user)
+}
+
+// SkipOAuthLink godoc
+// @Summary 不关联并创建新账号
+// @Description 不关联同邮箱的本地账号，以三方账号创建独立的账号并登录
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} LoginResponse
+// @Router /api/oauth/pending/skip [post]
+func SkipOAuthLink(c *gin.Context) {
+	token, link, ok := loadPendingOAuthLink(c)
+	if !ok {
+		return
+	}
+	dropPendingOAuthLink(c, token)
+
+	user, err := findOrCreateOAuthUser(link.siteID, &link.profile, nil)
+	if err != nil {
+		respondOAuthUserError(c, err)
+		return
+	}
+	issueSession(c, user)
+}
+
+// oauthLinkCandidate 返回可与三方账号关联的本地账号
+// 仅在三方账号尚未登录过且渠道确认邮箱已验证时，按邮箱查找本地账号，没有时返回 nil
+func oauthLinkCandidate(siteID uint, profile *oauth.Profile) (*models.User, error) {
+	email := strings.ToLower(strings.TrimSpace(profile.Email))
+	if !profile.EmailVerified || email == "" {
+		return nil, nil
+	}
+
+	var existing models.User
+	err := findOAuthUser(siteID, profile, &existing)
+	if err == nil {
+		return nil, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	var local models.User
+	err = db.GetDB().Where("site_id = ? AND provider = ? AND username = ?", siteID, "local", email).First(&local).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &local, nil
+}
+
+// startPendingOAuthLink 保存待确认的关联并跳转回登录前的页面，地址带上 oauth_link=pending
+func startPendingOAuthLink(c *gin.Context, siteID uint, profile *oauth.Profile) {
+	token, err := oauth.GenerateState()
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "生成登录状态失败")
+		return
+	}
+
+	now := time.Now()
+	pendingMu.Lock()
+	for key, link := range pendingLinks {
+		if now.After(link.expiresAt) {
+			delete(pendingLinks, key)
+		}
+	}
+	pendingLinks[token] = &pendingOAuthLink{
+		siteID:    siteID,
+		profile:   *profile,
+		expiresAt: now.Add(oauthCookieMaxAge * time.Second),
+	}
+	pendingMu.Unlock()
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthPendingCookie, token, oauthCookieMaxAge, "/api/oauth", "", c.Request.TLS != nil, true)
+
+	target, err := url.Parse(oauthRedirectTarget(c))
+	if err != nil {
+		target = &url.URL{Path: "/"}
+	}
+	query := target.Query()
+	query.Set("oauth_link", "pending")
+	target.RawQuery = query.Encode()
+	c.Redirect(http.StatusFound, target.String())
+}
+
+// loadPendingOAuthLink 读取当前站点待确认的关联，不存在或已过期时直接响应 404
+func loadPendingOAuthLink(c *gin.Context) (string, *pendingOAuthLink, bool) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return "", nil, false
+	}
+
+	token, _ := c.Cookie(oauthPendingCookie)
+	pendingMu.Lock()
+	link, ok := pendingLinks[token]
+	if ok && time.Now().After(link.expiresAt) {
+		delete(pendingLinks, token)
+		ok = false
+	}
+	pendingMu.Unlock()
+	if !ok || link.siteID != site.ID {
+		response.RespondWithError(c, http.StatusNotFound, "没有待确认的关联或已过期，请重新登录")
+		return "", nil, false
+	}
+	return token, link, true
+}
+
+// dropPendingOAuthLink 删除待确认的关联并清除 Cookie
+func dropPendingOAuthLink(c *gin.Context, token string) {
+	pendingMu.Lock()
+	delete(pendingLinks, token)
+	pendingMu.Unlock()
+	c.SetCookie(oauthPendingCookie, "", -1, "/api/oauth", "", c.Request.TLS != nil, true)
+}
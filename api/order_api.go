@@ -0,0 +1,345 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"qlist/billing"
+	"qlist/db"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/response"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PointPackageRequest 定义保存充值套餐的请求体，id 为 0 时创建新套餐
+type PointPackageRequest struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	PriceCents  int64  `json:"price_cents"`
+	Points      int    `json:"points"`
+	Enabled     *bool  `json:"enabled"` // 不传时默认启用
+	Sort        int    `json:"sort"`
+}
+
+// CreateOrderRequest 定义创建充值订单的请求体
+type CreateOrderRequest struct {
+	PackageID uint `json:"package_id"`
+}
+
+// GetPointPackages godoc
+// @Summary 获取充值套餐
+// @Description 获取当前站点可购买的积分充值套餐
+// @Tags Orders
+// @Produce json
+// @Success 200 {array} models.PointPackage
+// @Router /api/packages [get]
+func GetPointPackages(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var packages []models.PointPackage
+	if err := db.GetDB().Where("site_id = ? AND enabled = ?", site.ID, true).Order("sort, price_cents").Find(&packages).Error; err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取充值套餐")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, packages)
+}
+
+// GetAllPointPackages godoc
+// @Summary 获取全部充值套餐
+// @Description 获取当前站点的全部充值套餐，包括已停用的套餐
+// @Tags Orders
+// @Produce json
+// @Success 200 {array} models.PointPackage
+// @Router /api/packages/all [get]
+func GetAllPointPackages(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var packages []models.PointPackage
+	if err := db.GetDB().Where("site_id = ?", site.ID).Order("sort, price_cents").Find(&packages).Error; err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取充值套餐")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, packages)
+}
+
+// SavePointPackage godoc
+// @Summary 保存充值套餐
+// @Description 创建或更新积分充值套餐，价格以分为单位。修改套餐不影响已创建的订单
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param package body PointPackageRequest true "充值套餐"
+// @Success 200 {object} models.PointPackage
+// @Router /api/packages [post]
+func SavePointPackage(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var req PointPackageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.PriceCents <= 0 || req.Points <= 0 {
+		response.RespondWithError(c, http.StatusBadRequest, "套餐名称不能为空，价格和积分必须大于 0")
+		return
+	}
+
+	var pkg models.PointPackage
+	if req.ID != 0 {
+		if err := db.GetDB().Where("id = ? AND site_id = ?", req.ID, site.ID).First(&pkg).Error; err != nil {
+			response.RespondWithError(c, http.StatusNotFound, "充值套餐不存在")
+			return
+		}
+	}
+	pkg.SiteID = site.ID
+	pkg.Name = req.Name
+	pkg.Description = req.Description
+	pkg.PriceCents = req.PriceCents
+	pkg.Points = req.Points
+	pkg.Enabled = req.Enabled == nil || *req.Enabled
+	pkg.Sort = req.Sort
+
+	if pkg.ID == 0 {
+		if err := db.GetDB().Create(&pkg).Error; err != nil {
+			response.RespondWithError(c, http.StatusInternalServerError, "创建充值套餐失败")
+			return
+		}
+	} else {
+		// 显式选择字段，避免停用时 enabled 的 false 被当作零值忽略
+		if err := db.GetDB().Model(&pkg).Select("name", "description", "price_cents", "points", "enabled", "sort").Updates(pkg).Error; err != nil {
+			response.RespondWithError(c, http.StatusInternalServerError, "更新充值套餐失败")
+			return
+		}
+	}
+	response.RespondWithJSON(c, http.StatusOK, pkg)
+}
+
+// DeletePointPackage godoc
+// @Summary 删除充值套餐
+// @Description 删除当前站点的充值套餐，已创建的订单不受影响
+// @Tags Orders
+// @Produce json
+// @Param id path int true "套餐ID"
+// @Success 200 {object} map[string]string
+// @Router /api/packages/{id} [delete]
+func DeletePointPackage(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	result := db.GetDB().Where("id = ? AND site_id = ?", c.Param("id"), site.ID).Delete(&models.PointPackage{})
+	if result.Error != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "删除充值套餐失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.RespondWithError(c, http.StatusNotFound, "充值套餐不存在")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, gin.H{"message": "充值套餐已删除"})
+}
+
+// CreateOrder godoc
+// @Summary 创建充值订单
+// @Description 按套餐创建待支付的积分充值订单，超过支付时间未支付的订单自动过期
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param order body CreateOrderRequest true "充值套餐"
+// @Success 200 {object} models.Order
+// @Router /api/orders [post]
+func CreateOrder(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	var req CreateOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.PackageID == 0 {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+
+	order, err := billing.CreateOrder(site.ID, user.ID, req.PackageID)
+	if err != nil {
+		if errors.Is(err, billing.ErrPackageUnavailable) {
+			response.RespondWithError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		response.RespondWithError(c, http.StatusInternalServerError, "创建订单失败")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, order)
+}
+
+// GetOrders godoc
+// @Summary 获取充值订单
+// @Description 获取当前用户的积分充值订单，按创建时间倒序
+// @Tags Orders
+// @Produce json
+// @Param status query string false "订单状态：created, paid, fulfilled, refunded, expired"
+// @Success 200 {array} models.Order
+// @Router /api/orders [get]
+func GetOrders(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	query := db.GetDB().Where("user_id = ? AND site_id = ?", user.ID, site.ID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var orders []models.Order
+	if err := query.Order("created_at desc").Find(&orders).Error; err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取充值订单")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, orders)
+}
+
+// GetOrder godoc
+// @Summary 查询充值订单
+// @Description 按订单号查询当前用户的充值订单，用于支付后轮询订单状态
+// @Tags Orders
+// @Produce json
+// @Param order_no path string true "订单号"
+// @Success 200 {object} models.Order
+// @Router /api/orders/{order_no} [get]
+func GetOrder(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	order, err := billing.FindOrder(c.Param("order_no"))
+	if err != nil && !errors.Is(err, billing.ErrOrderNotFound) {
+		response.RespondWithError(c, http.StatusInternalServerError, "查询订单失败")
+		return
+	}
+	if order == nil || order.SiteID != site.ID || order.UserID != user.ID {
+		response.RespondWithError(c, http.StatusNotFound, billing.ErrOrderNotFound.Error())
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, order)
+}
+
+// AdminFulfillOrder godoc
+// @Summary 确认线下支付
+// @Description 管理员确认订单已通过线下方式付款，将订单标记为已支付并发放积分。重复确认不会重复发放
+// @Tags Orders
+// @Produce json
+// @Param order_no path string true "订单号"
+// @Success 200 {object} models.Order
+// @Router /api/orders/{order_no}/fulfill [post]
+func AdminFulfillOrder(c *gin.Context) {
+	order, ok := loadSiteOrder(c)
+	if !ok {
+		return
+	}
+
+	if order.Status == models.OrderCreated || order.Status == models.OrderExpired {
+		if _, err := billing.MarkPaid(order.OrderNo, "manual", "", order.AmountCents); err != nil {
+			respondOrderError(c, err, "更新订单状态失败")
+			return
+		}
+	}
+	order, err := billing.Fulfill(order.OrderNo)
+	if err != nil {
+		respondOrderError(c, err, "发放积分失败")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, order)
+}
+
+// AdminRefundOrder godoc
+// @Summary 退款充值订单
+// @Description 将订单标记为已退款，已发放的积分从用户余额中扣回，余额不足时无法退款。退款资金需通过支付渠道另行处理
+// @Tags Orders
+// @Produce json
+// @Param order_no path string true "订单号"
+// @Success 200 {object} models.Order
+// @Router /api/orders/{order_no}/refund [post]
+func AdminRefundOrder(c *gin.Context) {
+	order, ok := loadSiteOrder(c)
+	if !ok {
+		return
+	}
+
+	order, err := billing.Refund(order.OrderNo)
+	if err != nil {
+		respondOrderError(c, err, "退款失败")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, order)
+}
+
+// loadSiteOrder 查询路径参数中属于当前站点的订单，失败时已写入响应
+func loadSiteOrder(c *gin.Context) (*models.Order, bool) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return nil, false
+	}
+
+	order, err := billing.FindOrder(c.Param("order_no"))
+	if err != nil && !errors.Is(err, billing.ErrOrderNotFound) {
+		response.RespondWithError(c, http.StatusInternalServerError, "查询订单失败")
+		return nil, false
+	}
+	if order == nil || order.SiteID != site.ID {
+		response.RespondWithError(c, http.StatusNotFound, billing.ErrOrderNotFound.Error())
+		return nil, false
+	}
+	return order, true
+}
+
+// respondOrderError 将订单操作的错误转换为响应，未知错误使用 message
+func respondOrderError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, billing.ErrOrderNotFound):
+		response.RespondWithError(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, billing.ErrInvalidStatus), errors.Is(err, billing.ErrInsufficientPoints):
+		response.RespondWithError(c, http.StatusConflict, err.Error())
+	case errors.Is(err, billing.ErrAmountMismatch):
+		response.RespondWithError(c, http.StatusBadRequest, err.Error())
+	default:
+		response.RespondWithError(c, http.StatusInternalServerError, message)
+	}
+}
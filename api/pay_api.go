@@ -0,0 +1,224 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"qlist/billing"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/response"
+	"qlist/pkg/wechatpay"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxNotifyBodySize 支付回调请求体的大小上限
+const maxNotifyBodySize = 64 << 10
+
+// errPaymentException 支付通知无法入账且重试也不会成功，已记录为异常支付
+var errPaymentException = errors.New("支付无法入账，已记录为异常支付")
+
+// WechatPayRequest 定义发起微信支付的请求体
+type WechatPayRequest struct {
+	Method string `json:"method"` // native 扫码支付，jsapi 微信内支付
+	OpenID string `json:"openid"` // jsapi 支付时必填，用户在配置的 appid 下的 openid
+}
+
+// WechatPayResponse 发起微信支付的结果，native 返回二维码内容，jsapi 返回调起支付的参数
+type WechatPayResponse struct {
+	OrderNo   string                 `json:"orderNo"`
+	CodeURL   string                 `json:"codeUrl,omitempty"`
+	JSAPI     *wechatpay.JSAPIParams `json:"jsapi,omitempty"`
+	ExpiresAt time.Time              `json:"expiresAt"`
+}
+
+// WechatPayOrder godoc
+// @Summary 微信支付充值订单
+// @Description 为待支付的充值订单发起微信支付。native 返回 codeUrl，由前端生成二维码供用户扫码；jsapi 返回在微信内调起支付的参数。支付结果以回调为准，前端可轮询订单状态
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param order_no path string true "订单号"
+// @Param pay body WechatPayRequest true "支付方式"
+// @Success 200 {object} WechatPayResponse
+// @Router /api/orders/{order_no}/wechat [post]
+func WechatPayOrder(c *gin.Context) {
+	if !wechatpay.Enabled() {
+		response.RespondWithError(c, http.StatusNotFound, "未启用微信支付")
+		return
+	}
+	order, req, ok := loadPayableOrder(c)
+	if !ok {
+		return
+	}
+
+	payOrder := wechatPayOrder(order)
+	result := WechatPayResponse{OrderNo: order.OrderNo, ExpiresAt: order.ExpiresAt}
+	var err error
+	if req.Method == "jsapi" {
+		result.JSAPI, err = wechatpay.CreateJSAPI(payOrder, req.OpenID)
+	} else {
+		result.CodeURL, err = wechatpay.CreateNative(payOrder)
+	}
+	if err != nil {
+		log.Printf("微信支付下单失败 %s: %v", order.OrderNo, err)
+		response.RespondWithError(c, http.StatusBadGateway, "微信支付下单失败")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, result)
+}
+
+// SimulateWechatPay godoc
+// @Summary 模拟微信支付成功
+// @Description 仅在开发环境的模拟模式下可用。生成与真实回调相同格式的已签名、已加密的支付成功通知，按回调流程校验后发放积分
+// @Tags Orders
+// @Accept json
+// @Produce json
+// @Param order_no path string true "订单号"
+// @Param pay body WechatPayRequest true "支付方式"
+// @Success 200 {object} models.Order
+// @Router /api/orders/{order_no}/wechat/simulate [post]
+func SimulateWechatPay(c *gin.Context) {
+	if !wechatpay.Simulated() || !middleware.IsDev() {
+		response.RespondWithError(c, http.StatusNotFound, "未启用微信支付模拟模式")
+		return
+	}
+	order, req, ok := loadPayableOrder(c)
+	if !ok {
+		return
+	}
+
+	header, body, err := wechatpay.SimulateNotification(wechatPayOrder(order), strings.ToUpper(req.Method), req.OpenID)
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "生成模拟回调失败")
+		return
+	}
+	order, err = handleWechatNotification(header, body)
+	if err != nil {
+		respondOrderError(c, err, "处理支付结果失败")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, order)
+}
+
+// WechatPayNotify godoc
+// @Summary 微信支付回调
+// @Description 接收微信支付的支付结果通知，校验签名并解密后将订单标记为已支付并发放积分。重复通知不会重复发放。订单不存在、金额不一致或订单已退款等无法入账的通知记录为异常支付后同样应答 204，避免微信重发
+// @Tags Orders
+// @Accept json
+// @Success 204
+// @Router /api/pay/wechat/notify [post]
+func WechatPayNotify(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxNotifyBodySize))
+	if err != nil {
+		respondWechatNotify(c, http.StatusBadRequest, "读取通知失败")
+		return
+	}
+
+	if _, err := handleWechatNotification(c.Request.Header, body); err != nil {
+		log.Printf("处理微信支付回调失败: %v", err)
+		switch {
+		case errors.Is(err, wechatpay.ErrInvalidSignature):
+			respondWechatNotify(c, http.StatusUnauthorized, "签名校验失败")
+		case errors.Is(err, errPaymentException):
+			// 重试也无法入账，已记录为异常支付，应答成功避免微信持续重发
+			c.Status(http.StatusNoContent)
+		default:
+			respondWechatNotify(c, http.StatusInternalServerError, "处理支付结果失败")
+		}
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// handleWechatNotification 校验并处理支付结果通知，支付成功时标记订单已支付并发放积分
+// 非成功状态的通知直接返回 nil，不改变订单；订单不存在、金额不一致或状态不允许入账时记录异常支付并返回 errPaymentException
+func handleWechatNotification(header http.Header, body []byte) (*models.Order, error) {
+	transaction, err := wechatpay.ParseNotification(header, body)
+	if err != nil {
+		return nil, err
+	}
+	if transaction.TradeState != wechatpay.TradeStateSuccess {
+		return nil, nil
+	}
+
+	payMethod := "wechat_" + strings.ToLower(transaction.TradeType)
+	if _, err := billing.MarkPaid(transaction.OutTradeNo, payMethod, transaction.TransactionID, transaction.Amount.Total); err != nil {
+		if !errors.Is(err, billing.ErrOrderNotFound) && !errors.Is(err, billing.ErrAmountMismatch) && !errors.Is(err, billing.ErrInvalidStatus) {
+			return nil, err
+		}
+		if recordErr := billing.RecordPaymentException(transaction.OutTradeNo, payMethod, transaction.TransactionID, transaction.Amount.Total, err); recordErr != nil {
+			// 记录失败时按临时错误处理，让微信稍后重发
+			return nil, recordErr
+		}
+		log.Printf("微信支付交易 %s 无法入账，已记录为异常支付: 订单 %s, 金额 %d 分: %v", transaction.TransactionID, transaction.OutTradeNo, transaction.Amount.Total, err)
+		return nil, fmt.Errorf("%w: %w", errPaymentException, err)
+	}
+	return billing.Fulfill(transaction.OutTradeNo)
+}
+
+// loadPayableOrder 读取支付方式并查询当前用户待支付的订单，失败时已写入响应
+func loadPayableOrder(c *gin.Context) (*models.Order, *WechatPayRequest, bool) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return nil, nil, false
+	}
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusUnauthorized, "用户未登录")
+		return nil, nil, false
+	}
+
+	var req WechatPayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return nil, nil, false
+	}
+	if req.Method == "" {
+		req.Method = "native"
+	}
+	if req.Method != "native" && req.Method != "jsapi" {
+		response.RespondWithError(c, http.StatusBadRequest, "不支持的支付方式")
+		return nil, nil, false
+	}
+	if req.Method == "jsapi" && req.OpenID == "" {
+		response.RespondWithError(c, http.StatusBadRequest, "JSAPI 支付需要提供 openid")
+		return nil, nil, false
+	}
+
+	order, err := billing.FindOrder(c.Param("order_no"))
+	if err != nil && !errors.Is(err, billing.ErrOrderNotFound) {
+		response.RespondWithError(c, http.StatusInternalServerError, "查询订单失败")
+		return nil, nil, false
+	}
+	if order == nil || order.SiteID != site.ID || order.UserID != user.ID {
+		response.RespondWithError(c, http.StatusNotFound, billing.ErrOrderNotFound.Error())
+		return nil, nil, false
+	}
+	if order.Status != models.OrderCreated || !order.ExpiresAt.After(time.Now()) {
+		response.RespondWithError(c, http.StatusConflict, "订单已支付或已过期，请重新下单")
+		return nil, nil, false
+	}
+	return order, &req, true
+}
+
+// wechatPayOrder 转换为微信支付下单所需的订单信息
+func wechatPayOrder(order *models.Order) wechatpay.Order {
+	return wechatpay.Order{
+		OrderNo:     order.OrderNo,
+		Description: "积分充值-" + order.Subject,
+		AmountCents: order.AmountCents,
+		ExpiresAt:   order.ExpiresAt,
+	}
+}
+
+// respondWechatNotify 按微信支付要求的格式应答处理失败的回调，微信支付会稍后重试
+func respondWechatNotify(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{"code": "FAIL", "message": message})
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"qlist/billing"
+	"qlist/config"
+	"qlist/db"
+	"qlist/models"
+	"qlist/pkg/wechatpay"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestWechatPayNotify 重试也无法入账的回调记录为异常支付并应答 204，签名错误的回调返回 401
+func TestWechatPayNotify(t *testing.T) {
+	tests := []struct {
+		name          string
+		prepare       func(t *testing.T, order *models.Order) // 发送回调前对订单的处理
+		amount        int64                                   // 回调中的支付金额，0 表示与订单一致
+		tamper        bool
+		wantStatus    int
+		wantOrder     string // 回调后订单的状态
+		wantException bool
+	}{
+		{
+			name:       "支付成功",
+			wantStatus: http.StatusNoContent,
+			wantOrder:  models.OrderFulfilled,
+		},
+		{
+			name: "已退款的订单",
+			prepare: func(t *testing.T, order *models.Order) {
+				if _, err := billing.MarkPaid(order.OrderNo, "manual", "manual-1", order.AmountCents); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := billing.Refund(order.OrderNo); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStatus:    http.StatusNoContent,
+			wantOrder:     models.OrderRefunded,
+			wantException: true,
+		},
+		{
+			name:          "金额不一致",
+			amount:        1,
+			wantStatus:    http.StatusNoContent,
+			wantOrder:     models.OrderCreated,
+			wantException: true,
+		},
+		{
+			name:       "签名错误",
+			tamper:     true,
+			wantStatus: http.StatusUnauthorized,
+			wantOrder:  models.OrderCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Instance = config.AppConfig{
+				DBType:    "sqlite",
+				DBConn:    filepath.Join(t.TempDir(), "qlist.db") + "?_busy_timeout=10000&_txlock=immediate",
+				JWTSecret: "test-secret",
+			}
+			config.Instance.WechatPay.Simulate = true
+			config.Instance.WechatPay.AppID = "wx-test"
+			if err := db.InitDB(); err != nil {
+				t.Fatalf("初始化数据库失败: %v", err)
+			}
+
+			site := models.Site{Name: "test", Domain: "example.com"}
+			if err := db.GetDB().Create(&site).Error; err != nil {
+				t.Fatal(err)
+			}
+			user := models.User{SiteID: site.ID, Username: "u@example.com", Provider: "local", Points: 50}
+			if err := db.GetDB().Create(&user).Error; err != nil {
+				t.Fatal(err)
+			}
+			pkg := models.PointPackage{SiteID: site.ID, Name: "100 积分", PriceCents: 1000, Points: 100, Enabled: true}
+			if err := db.GetDB().Create(&pkg).Error; err != nil {
+				t.Fatal(err)
+			}
+			order, err := billing.CreateOrder(site.ID, user.ID, pkg.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.prepare != nil {
+				tt.prepare(t, order)
+			}
+
+			payOrder := wechatPayOrder(order)
+			if tt.amount != 0 {
+				payOrder.AmountCents = tt.amount
+			}
+			header, body, err := wechatpay.SimulateNotification(payOrder, "NATIVE", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tamper {
+				body = bytes.Replace(body, []byte("TRANSACTION.SUCCESS"), []byte("TRANSACTION.FAILURE"), 1)
+			}
+
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.POST("/api/pay/wechat/notify", WechatPayNotify)
+			req := httptest.NewRequest(http.MethodPost, "/api/pay/wechat/notify", bytes.NewReader(body))
+			req.Header = header
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("响应 %d，期望 %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			current, err := billing.FindOrder(order.OrderNo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if current.Status != tt.wantOrder {
+				t.Fatalf("订单状态 %s，期望 %s", current.Status, tt.wantOrder)
+			}
+			var exceptions int64
+			if err := db.GetDB().Model(&models.PaymentException{}).Where("order_no = ?", order.OrderNo).Count(&exceptions).Error; err != nil {
+				t.Fatal(err)
+			}
+			if (exceptions == 1) != tt.wantException {
+				t.Fatalf("异常支付记录 %d 条，期望记录: %v", exceptions, tt.wantException)
+			}
+		})
+	}
+}
@@ -1,13 +1,18 @@
 package api
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"qlist/config"
 	"qlist/db"
 	"qlist/middleware"
 	"qlist/models"
 	"qlist/pkg/response"
+	"qlist/pkg/signedurl"
+	"qlist/pricing"
 	"qlist/storage"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -38,7 +43,7 @@ func GetPointsList(c *gin.Context) {
 
 // ConfigurePoints godoc
 // @Summary 配置积分
-// @Description 为指定路径配置所需积分
+// @Description 为指定路径或文件配置所需积分
 // @Tags Points
 // @Accept json
 // @Produce json
@@ -59,27 +64,166 @@ func ConfigurePoints(c *gin.Context) {
 	}
 	config.SiteID = site.ID
 
-	var existingConfig models.PointConfig
-	err := db.GetDB().Where("site_id = ? AND file_id = ?", site.ID, config.FileID).First(&existingConfig).Error
-	if err != nil && err != gorm.ErrRecordNotFound {
-		response.RespondWithError(c, http.StatusInternalServerError, "查询积分配置失败")
+	// 可以按文件ID或路径配置，路径对应的文件尚未入库时同样允许定价
+	if config.FileID != nil {
+		var file models.File
+		if err := db.GetDB().Where("id = ? AND site_id = ?", *config.FileID, site.ID).First(&file).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				response.RespondWithError(c, http.StatusNotFound, "文件不存在")
+				return
+			}
+			response.RespondWithError(c, http.StatusInternalServerError, "查询文件失败")
+			return
+		}
+		config.Path = pricing.NormalizePath(file.Path)
+	} else if config.Path != "" {
+		config.Path = pricing.NormalizePath(config.Path)
+		var file models.File
+		err := db.GetDB().Where("site_id = ? AND path = ?", site.ID, config.Path).First(&file).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			response.RespondWithError(c, http.StatusInternalServerError, "查询文件失败")
+			return
+		}
+		if err == nil {
+			config.FileID = &file.ID
+		}
+	} else {
+		response.RespondWithError(c, http.StatusBadRequest, "文件路径不能为空")
+		return
+	}
+
+	if err := savePointConfig(&config); err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "保存积分配置失败")
 		return
 	}
 
+	response.RespondWithJSON(c, http.StatusOK, config)
+}
+
+// savePointConfig 按站点和路径保存积分配置，已存在时更新积分和描述
+func savePointConfig(config *models.PointConfig) error {
+	var existingConfig models.PointConfig
+	err := db.GetDB().Where("site_id = ? AND path = ?", config.SiteID, config.Path).First(&existingConfig).Error
 	if err == gorm.ErrRecordNotFound {
-		if err := db.GetDB().Create(&config).Error; err != nil {
-			response.RespondWithError(c, http.StatusInternalServerError, "创建积分配置失败")
+		return db.GetDB().Create(config).Error
+	}
+	if err != nil {
+		return err
+	}
+	if err := db.GetDB().Model(&existingConfig).Select("file_id", "points", "description").Updates(config).Error; err != nil {
+		return err
+	}
+	config.ID = existingConfig.ID
+	return nil
+}
+
+// AdminSetUploaderRequest 定义设置上传者的请求体
+type AdminSetUploaderRequest struct {
+	UserID     uint `json:"user_id"`
+	IsUploader bool `json:"is_uploader"`
+}
+
+// AdminSetUploader godoc
+// @Summary 设置上传者
+// @Description 授予或取消用户的上传权限
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param uploader_request body AdminSetUploaderRequest true "设置上传者请求"
+// @Success 200 {object} models.User
+// @Router /api/users/uploader [post]
+func AdminSetUploader(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var req AdminSetUploaderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+
+	var user models.User
+	if err := db.GetDB().Where("id = ? AND site_id = ?", req.UserID, site.ID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.RespondWithError(c, http.StatusNotFound, "用户不存在")
 			return
 		}
-	} else {
-		if err := db.GetDB().Model(&existingConfig).Updates(config).Error; err != nil {
-			response.RespondWithError(c, http.StatusInternalServerError, "更新积分配置失败")
+		response.RespondWithError(c, http.StatusInternalServerError, "查询用户失败")
+		return
+	}
+
+	if err := db.GetDB().Model(&user).Update("is_uploader", req.IsUploader).Error; err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "更新用户失败")
+		return
+	}
+
+	user.Password = ""
+	response.RespondWithJSON(c, http.StatusOK, user)
+}
+
+// AdminSetTierRequest 定义设置会员等级的请求体，tier 为空表示取消会员
+type AdminSetTierRequest struct {
+	UserID uint   `json:"user_id"`
+	Tier   string `json:"tier"`
+	Days   int    `json:"days"` // 会员有效天数，0 表示长期有效
+}
+
+// AdminSetTier godoc
+// @Summary 设置会员等级
+// @Description 为用户开通或取消会员，会员等级需在配置的 download.tiers 中定义，有效期内按等级的下载限制限速
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param tier_request body AdminSetTierRequest true "设置会员等级请求"
+// @Success 200 {object} models.User
+// @Router /api/users/tier [post]
+func AdminSetTier(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var req AdminSetTierRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Days < 0 {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+	if _, ok := config.Instance.Download.Tiers[req.Tier]; req.Tier != "" && !ok {
+		response.RespondWithError(c, http.StatusBadRequest, "会员等级不存在")
+		return
+	}
+
+	var user models.User
+	if err := db.GetDB().Where("id = ? AND site_id = ?", req.UserID, site.ID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.RespondWithError(c, http.StatusNotFound, "用户不存在")
 			return
 		}
-		config.ID = existingConfig.ID
+		response.RespondWithError(c, http.StatusInternalServerError, "查询用户失败")
+		return
 	}
 
-	response.RespondWithJSON(c, http.StatusOK, config)
+	var expiresAt *time.Time
+	if req.Tier != "" && req.Days > 0 {
+		t := time.Now().AddDate(0, 0, req.Days)
+		expiresAt = &t
+	}
+	if err := db.GetDB().Model(&user).Updates(map[string]interface{}{
+		"tier":            req.Tier,
+		"tier_expires_at": expiresAt,
+	}).Error; err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "更新用户失败")
+		return
+	}
+	user.Tier = req.Tier
+	user.TierExpiresAt = expiresAt
+
+	user.Password = ""
+	response.RespondWithJSON(c, http.StatusOK, user)
 }
 
 // GetUsersList godoc
@@ -102,6 +246,9 @@ func GetUsersList(c *gin.Context) {
 		response.RespondWithError(c, http.StatusInternalServerError, "无法获取用户列表")
 		return
 	}
+	for i := range users {
+		users[i].Password = ""
+	}
 	response.RespondWithJSON(c, http.StatusOK, users)
 }
 
@@ -134,45 +281,69 @@ func DownloadFile(c *gin.Context) {
 		return
 	}
 
-	var config models.PointConfig
-	if err := db.GetDB().Where("site_id = ? AND path = ?", site.ID, filePath).First(&config).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			response.RespondWithError(c, http.StatusNotFound, "文件未配置积分")
-			return
-		}
+	filePath = pricing.NormalizePath(filePath)
+	if isHiddenPath(filePath) {
+		response.RespondWithError(c, http.StatusNotFound, "文件不存在")
+		return
+	}
+
+	price, err := pricing.Resolve(site.ID, filePath)
+	if err != nil {
 		response.RespondWithError(c, http.StatusInternalServerError, "查询文件积分配置失败")
 		return
 	}
 
-	if currentUser.Points < config.Points {
-		response.RespondWithError(c, http.StatusForbidden, "积分不足")
+	driver, err := middleware.GetStorageFromContext(c)
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "获取站点存储失败")
 		return
 	}
 
-	tx := db.GetDB().Begin()
-	// 更新用户积分
-	if err := tx.Model(currentUser).Update("points", gorm.Expr("points - ?", config.Points)).Error; err != nil {
-		tx.Rollback()
-		response.RespondWithError(c, http.StatusInternalServerError, "扣除积分失败")
+	// 确认文件在存储中存在后再扣费
+	object, err := driver.Stat(c.Request.Context(), filePath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			response.RespondWithError(c, http.StatusNotFound, "文件不存在")
+			return
+		}
+		response.RespondWithError(c, http.StatusInternalServerError, "获取文件信息失败")
+		return
+	}
+	if object.IsDir {
+		response.RespondWithError(c, http.StatusBadRequest, "不能下载目录")
+		return
+	}
+	if _, ok := driver.(storage.Opener); !ok {
+		response.RespondWithError(c, http.StatusNotImplemented, "当前存储驱动不支持读取文件内容")
 		return
 	}
 
-	log := models.PointLog{
-		UserID:  currentUser.ID,
-		SiteID:  site.ID,
-		Points:  -config.Points,
-		Action:  "file_access",
-		Details: fmt.Sprintf("下载文件: %s", filePath),
+	file := price.File
+	if file == nil {
+		if file, err = ensureFile(site.ID, filePath); err != nil {
+			response.RespondWithError(c, http.StatusInternalServerError, "登记文件失败")
+			return
+		}
 	}
-	if err := tx.Create(&log).Error; err != nil {
-		tx.Rollback()
-		response.RespondWithError(c, http.StatusInternalServerError, "记录积分日志失败")
+
+	// 流量已用完时不再发放下载链接，实际流量在传输文件时统计
+	if err := checkQuota(db.GetDB(), site, currentUser.ID, false, object.Size); err != nil {
+		respondQuotaError(c, err)
 		return
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		response.RespondWithError(c, http.StatusInternalServerError, "提交事务失败")
+	// 首次下载扣除积分并记录购买，有效期内已购买的文件不重复扣费，也不计入付费下载次数
+	if _, err := purchaseFile(site, currentUser.ID, file, price.Points); err != nil {
+		if err == errInsufficientPoints {
+			response.RespondWithError(c, http.StatusForbidden, "积分不足")
+			return
+		}
+		var quotaErr *quotaExceededError
+		if errors.As(err, &quotaErr) {
+			respondQuotaError(c, err)
+			return
+		}
+		response.RespondWithError(c, http.StatusInternalServerError, "扣除积分失败")
 		return
 	}
 
@@ -182,19 +353,45 @@ func DownloadFile(c *gin.Context) {
 		fmt.Printf("更新文件下载次数失败: %v\n", err)
 	}
 
-	// 获取下载链接
-	uploader := &storage.AlistUploader{}
-	downloadUrl, err := uploader.GetDownloadUrl(filePath)
+	// 文件由服务端转发，客户端只拿到绑定用户和文件的限时链接，不接触存储地址和凭据
+	ttl := downloadLinkTTL()
+	token, err := signedurl.Sign(signedurl.Claims{
+		UserID: currentUser.ID,
+		SiteID: site.ID,
+		FileID: file.ID,
+		Path:   filePath,
+	}, ttl)
 	if err != nil {
-		response.RespondWithError(c, http.StatusInternalServerError, "获取下载链接失败")
+		response.RespondWithError(c, http.StatusInternalServerError, "生成下载链接失败")
 		return
 	}
 
 	response.RespondWithJSON(c, http.StatusOK, gin.H{
-		"url": downloadUrl,
+		"url":       "/d/" + token,
+		"expiresAt": time.Now().Add(ttl),
 	})
 }
 
+// errInsufficientPoints 用户积分不足
+var errInsufficientPoints = errors.New("积分不足")
+
+// deductPoints 在事务中扣减用户积分，仅当余额足够时才会更新
+func deductPoints(tx *gorm.DB, userID, siteID uint, points int) error {
+	if points <= 0 {
+		return nil
+	}
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND site_id = ? AND points >= ?", userID, siteID, points).
+		Update("points", gorm.Expr("points - ?", points))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInsufficientPoints
+	}
+	return nil
+}
+
 // AdminGrantPointsRequest 定义管理员授予积分的请求体
 type AdminGrantPointsRequest struct {
 	UserID uint `json:"user_id"`
@@ -234,12 +431,19 @@ func AdminGrantPoints(c *gin.Context) {
 	}
 
 	tx := db.GetDB().Begin()
-	user.Points += req.Points
-	if err := tx.Save(&user).Error; err != nil {
+	result := tx.Model(&models.User{}).
+		Where("id = ? AND site_id = ? AND points + ? >= 0", user.ID, site.ID, req.Points).
+		Update("points", gorm.Expr("points + ?", req.Points))
+	if result.Error != nil {
 		tx.Rollback()
 		response.RespondWithError(c, http.StatusInternalServerError, "更新用户积分失败")
 		return
 	}
+	if result.RowsAffected == 0 && req.Points != 0 {
+		tx.Rollback()
+		response.RespondWithError(c, http.StatusBadRequest, "扣除后积分不能为负数")
+		return
+	}
 
 	log := models.PointLog{
 		UserID:  user.ID,
@@ -259,6 +463,11 @@ func AdminGrantPoints(c *gin.Context) {
 		return
 	}
 
+	if err := db.GetDB().First(&user, user.ID).Error; err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "查询用户失败")
+		return
+	}
+	user.Password = ""
 	response.RespondWithJSON(c, http.StatusOK, user)
 }
 
@@ -276,7 +485,9 @@ func GetUserPoints(c *gin.Context) {
 		response.RespondWithError(c, http.StatusUnauthorized, "用户未登录")
 		return
 	}
-	response.RespondWithJSON(c, http.StatusOK, user.(*models.User))
+	currentUser := *user.(*models.User)
+	currentUser.Password = ""
+	response.RespondWithJSON(c, http.StatusOK, currentUser)
 }
 
 // GetPointsLog godoc
@@ -311,12 +522,12 @@ func GetPointsLog(c *gin.Context) {
 
 // GetFileInfo godoc
 // @Summary 获取文件信息
-// @Description 根据路径获取文件的积分配置信息
+// @Description 根据路径获取文件的价格，并返回生效的单文件配置或定价规则，便于排查价格
 // @Tags Points
 // @Accept json
 // @Produce json
 // @Param path query string true "文件路径"
-// @Success 200 {object} models.PointConfig
+// @Success 200 {object} pricing.Price
 // @Router /api/fileinfo [get]
 func GetFileInfo(c *gin.Context) {
 	site, exists := middleware.GetSiteFromContext(c)
@@ -331,15 +542,17 @@ func GetFileInfo(c *gin.Context) {
 		return
 	}
 
-	var config models.PointConfig
-	if err := db.GetDB().Where("site_id = ? AND path = ?", site.ID, filePath).First(&config).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			response.RespondWithError(c, http.StatusNotFound, "文件未配置积分")
-			return
-		}
+	filePath = pricing.NormalizePath(filePath)
+	if isHiddenPath(filePath) {
+		response.RespondWithError(c, http.StatusNotFound, "文件不存在")
+		return
+	}
+
+	price, err := pricing.Resolve(site.ID, filePath)
+	if err != nil {
 		response.RespondWithError(c, http.StatusInternalServerError, "查询文件积分配置失败")
 		return
 	}
 
-	response.RespondWithJSON(c, http.StatusOK, config)
+	response.RespondWithJSON(c, http.StatusOK, price)
 }
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http"
+	"qlist/db"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/response"
+	"qlist/pricing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetPriceRules godoc
+// @Summary 获取定价规则列表
+// @Description 获取当前站点的目录与通配符定价规则
+// @Tags Points
+// @Produce json
+// @Success 200 {array} models.PriceRule
+// @Router /api/points/rules [get]
+func GetPriceRules(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var rules []models.PriceRule
+	if err := db.GetDB().Where("site_id = ?", site.ID).Order("pattern").Find(&rules).Error; err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取定价规则")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, rules)
+}
+
+// SavePriceRule godoc
+// @Summary 保存定价规则
+// @Description 为目录前缀（如 /courses）或通配符（如 /courses/**/*.mp4）配置积分，相同规则已存在时更新
+// @Tags Points
+// @Accept json
+// @Produce json
+// @Param rule body models.PriceRule true "定价规则"
+// @Success 200 {object} models.PriceRule
+// @Router /api/points/rules [post]
+func SavePriceRule(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var rule models.PriceRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+	pattern, err := pricing.NormalizePattern(rule.Pattern)
+	if err != nil {
+		response.RespondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	rule.Pattern = pattern
+	rule.SiteID = site.ID
+
+	var existingRule models.PriceRule
+	err = db.GetDB().Where("site_id = ? AND pattern = ?", site.ID, rule.Pattern).First(&existingRule).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		response.RespondWithError(c, http.StatusInternalServerError, "查询定价规则失败")
+		return
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		rule.ID = 0
+		if err := db.GetDB().Create(&rule).Error; err != nil {
+			response.RespondWithError(c, http.StatusInternalServerError, "创建定价规则失败")
+			return
+		}
+	} else {
+		if err := db.GetDB().Model(&existingRule).Select("points", "description").Updates(rule).Error; err != nil {
+			response.RespondWithError(c, http.StatusInternalServerError, "更新定价规则失败")
+			return
+		}
+		rule.ID = existingRule.ID
+	}
+
+	response.RespondWithJSON(c, http.StatusOK, rule)
+}
+
+// DeletePriceRule godoc
+// @Summary 删除定价规则
+// @Description 删除当前站点的定价规则
+// @Tags Points
+// @Produce json
+// @Param id path int true "规则ID"
+// @Success 200 {object} map[string]string
+// @Router /api/points/rules/{id} [delete]
+func DeletePriceRule(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	result := db.GetDB().Unscoped().Where("id = ? AND site_id = ?", c.Param("id"), site.ID).Delete(&models.PriceRule{})
+	if result.Error != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "删除定价规则失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.RespondWithError(c, http.StatusNotFound, "定价规则不存在")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, gin.H{"message": "删除成功"})
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"fmt"
+	"hash/fnv"
+	"qlist/config"
+	"qlist/db"
+	"qlist/models"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// findValidPurchase 查询用户在当前站点对文件的有效购买记录，不存在时返回 nil
+func findValidPurchase(tx *gorm.DB, userID, siteID, fileID uint) (*models.Purchase, error) {
+	var purchase models.Purchase
+	err := tx.Where("user_id = ? AND site_id = ? AND file_id = ?", userID, siteID, fileID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		First(&purchase).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &purchase, nil
+}
+
+// purchaseLocks 按站点和用户的哈希串行化付费下载，避免并发请求同时通过付费下载次数的检查
+// 锁的数量固定，不随用户数增长，哈希相同的用户偶尔互相等待
+var purchaseLocks [64]sync.Mutex
+
+// lockPurchase 锁定用户的付费下载，返回解锁函数
+func lockPurchase(siteID, userID uint) func() {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%d", siteID, userID)
+	lock := &purchaseLocks[h.Sum32()%uint32(len(purchaseLocks))]
+	lock.Lock()
+	return lock.Unlock
+}
+
+// purchaseFile 扣除积分并记录购买，购买记录的查询、续期、配额检查、扣费和积分日志在同一事务中完成
+// 有效期内已购买过的文件直接返回 false，不重复扣费；免费文件不写购买记录和积分日志
+// 超出付费下载次数时返回 *quotaExceededError
+func purchaseFile(site *models.Site, userID uint, file *models.File, points int) (bool, error) {
+	if points <= 0 {
+		return false, nil
+	}
+	siteID := site.ID
+	defer lockPurchase(siteID, userID)()
+
+	var expiresAt *time.Time
+	if config.Instance.PurchaseValidDays > 0 {
+		t := time.Now().AddDate(0, 0, config.Instance.PurchaseValidDays)
+		expiresAt = &t
+	}
+
+	tx := db.GetDB().Begin()
+	// 同一文件只保留一条购买记录，过期或被删除后再次购买时续期
+	var purchase models.Purchase
+	err := tx.Unscoped().Where("user_id = ? AND site_id = ? AND file_id = ?", userID, siteID, file.ID).First(&purchase).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		tx.Rollback()
+		return false, err
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		purchase = models.Purchase{
+			UserID:    userID,
+			SiteID:    siteID,
+			FileID:    file.ID,
+			Points:    points,
+			ExpiresAt: expiresAt,
+		}
+		if err := tx.Create(&purchase).Error; err != nil {
+			tx.Rollback()
+			// 并发的首次购买会因唯一索引冲突失败，此时另一请求已完成扣费
+			if existing, findErr := findValidPurchase(db.GetDB(), userID, siteID, file.ID); findErr == nil && existing != nil {
+				return false, nil
+			}
+			return false, err
+		}
+	} else {
+		// 以过期为条件续期，并发的续期只有一个能更新成功并扣费
+		now := time.Now()
+		result := tx.Unscoped().Model(&models.Purchase{}).
+			Where("id = ? AND (deleted_at IS NOT NULL OR (expires_at IS NOT NULL AND expires_at <= ?))", purchase.ID, now).
+			Updates(map[string]interface{}{
+				"points":     points,
+				"expires_at": expiresAt,
+				"deleted_at": nil,
+				"updated_at": now,
+			})
+		if result.Error != nil {
+			tx.Rollback()
+			return false, result.Error
+		}
+		if result.RowsAffected != 1 {
+			tx.Rollback()
+			return false, nil
+		}
+	}
+
+	if err := deductPoints(tx, userID, siteID, points); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	// 扣减积分已锁定用户行，此时统计的付费下载次数包含其他已提交的购买
+	if err := checkQuota(tx, site, userID, true, 0); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	log := models.PointLog{
+		UserID:  userID,
+		SiteID:  siteID,
+		Points:  -points,
+		Action:  "file_access",
+		Details: fmt.Sprintf("下载文件: %s", file.Path),
+	}
+	if err := tx.Create(&log).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if err := tx.Model(&models.Purchase{}).Where("id = ?", purchase.ID).Update("point_log_id", log.ID).Error; err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
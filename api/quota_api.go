@@ -0,0 +1,232 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"qlist/config"
+	"qlist/db"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/response"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// QuotaUsage 用户在一个统计周期内的下载配额使用情况，上限为 0 表示不限制
+type QuotaUsage struct {
+	Period        string    `json:"period"` // day 或 month
+	Downloads     int64     `json:"downloads"`
+	DownloadLimit int       `json:"downloadLimit"`
+	Traffic       int64     `json:"traffic"`      // 已下载的流量（字节）
+	TrafficLimit  int64     `json:"trafficLimit"` // 流量上限（字节）
+	ResetAt       time.Time `json:"resetAt"`
+}
+
+// quotaExceededError 超出下载配额，包含配额重置的时间
+type quotaExceededError struct {
+	message string
+	resetAt time.Time
+}
+
+func (e *quotaExceededError) Error() string {
+	return e.message
+}
+
+// SiteQuotaRequest 定义保存站点下载配额的请求体，为 0 的项使用配置文件中的默认值
+type SiteQuotaRequest struct {
+	DailyDownloads   int   `json:"daily_downloads"`
+	MonthlyDownloads int   `json:"monthly_downloads"`
+	DailyTraffic     int64 `json:"daily_traffic"`   // MB
+	MonthlyTraffic   int64 `json:"monthly_traffic"` // MB
+}
+
+// GetUserQuota godoc
+// @Summary 查询下载配额
+// @Description 查询当前用户今天和本月的付费下载次数、下载流量以及重置时间
+// @Tags Users
+// @Produce json
+// @Success 200 {array} QuotaUsage
+// @Router /api/users/quota [get]
+func GetUserQuota(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+	user, exists := middleware.GetUserFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusUnauthorized, "用户未登录")
+		return
+	}
+
+	usages, err := quotaUsage(db.GetDB(), user.ID, site.ID, siteQuota(site), time.Now())
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "查询下载配额失败")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, usages)
+}
+
+// GetSiteQuota godoc
+// @Summary 获取站点下载配额
+// @Description 获取当前站点生效的用户下载配额
+// @Tags Points
+// @Produce json
+// @Success 200 {object} models.DownloadQuota
+// @Router /api/quota [get]
+func GetSiteQuota(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, siteQuota(site))
+}
+
+// SaveSiteQuota godoc
+// @Summary 保存站点下载配额
+// @Description 设置当前站点每个用户每天和每月的付费下载次数及流量（MB）上限，为 0 的项使用配置文件中的默认值
+// @Tags Points
+// @Accept json
+// @Produce json
+// @Param quota body SiteQuotaRequest true "下载配额"
+// @Success 200 {object} models.DownloadQuota
+// @Router /api/quota [post]
+func SaveSiteQuota(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var req SiteQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil ||
+		req.DailyDownloads < 0 || req.MonthlyDownloads < 0 || req.DailyTraffic < 0 || req.MonthlyTraffic < 0 {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+	quota := models.DownloadQuota(req)
+
+	if err := db.GetDB().Model(site).Updates(map[string]interface{}{
+		"quota_daily_downloads":   quota.DailyDownloads,
+		"quota_monthly_downloads": quota.MonthlyDownloads,
+		"quota_daily_traffic":     quota.DailyTraffic,
+		"quota_monthly_traffic":   quota.MonthlyTraffic,
+	}).Error; err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "保存下载配额失败")
+		return
+	}
+	site.Quota = quota
+
+	response.RespondWithJSON(c, http.StatusOK, siteQuota(site))
+}
+
+// siteQuota 返回站点生效的下载配额，站点未设置的项使用配置文件中的默认值
+func siteQuota(site *models.Site) models.DownloadQuota {
+	quota := models.DownloadQuota{
+		DailyDownloads:   config.Instance.Quota.DailyDownloads,
+		MonthlyDownloads: config.Instance.Quota.MonthlyDownloads,
+		DailyTraffic:     config.Instance.Quota.DailyTraffic,
+		MonthlyTraffic:   config.Instance.Quota.MonthlyTraffic,
+	}
+	if site.Quota.DailyDownloads > 0 {
+		quota.DailyDownloads = site.Quota.DailyDownloads
+	}
+	if site.Quota.MonthlyDownloads > 0 {
+		quota.MonthlyDownloads = site.Quota.MonthlyDownloads
+	}
+	if site.Quota.DailyTraffic > 0 {
+		quota.DailyTraffic = site.Quota.DailyTraffic
+	}
+	if site.Quota.MonthlyTraffic > 0 {
+		quota.MonthlyTraffic = site.Quota.MonthlyTraffic
+	}
+	return quota
+}
+
+// quotaUsage 统计用户今天和本月的配额使用情况
+// 付费下载次数来自扣除积分的 file_access 日志，流量来自实际传输文件的下载记录，均按服务器所在时区的自然日和自然月统计
+func quotaUsage(tx *gorm.DB, userID, siteID uint, quota models.DownloadQuota, now time.Time) ([]QuotaUsage, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	periods := []QuotaUsage{
+		{Period: "day", DownloadLimit: quota.DailyDownloads, TrafficLimit: quota.DailyTraffic << 20, ResetAt: today.AddDate(0, 0, 1)},
+		{Period: "month", DownloadLimit: quota.MonthlyDownloads, TrafficLimit: quota.MonthlyTraffic << 20, ResetAt: thisMonth.AddDate(0, 1, 0)},
+	}
+	starts := []time.Time{today, thisMonth}
+	for i := range periods {
+		if err := tx.Model(&models.PointLog{}).
+			Where("user_id = ? AND site_id = ? AND action = ? AND points < 0 AND created_at >= ?", userID, siteID, "file_access", starts[i]).
+			Count(&periods[i].Downloads).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&models.DownloadLog{}).
+			Where("user_id = ? AND site_id = ? AND created_at >= ?", userID, siteID, starts[i]).
+			Select("COALESCE(SUM(size), 0)").
+			Scan(&periods[i].Traffic).Error; err != nil {
+			return nil, err
+		}
+	}
+	return periods, nil
+}
+
+// checkQuota 检查本次下载是否会超出配额，paid 表示本次下载需要扣除积分，size 为将要传输的字节数
+// 超出时返回 *quotaExceededError
+func checkQuota(tx *gorm.DB, site *models.Site, userID uint, paid bool, size int64) error {
+	quota := siteQuota(site)
+	if quota == (models.DownloadQuota{}) {
+		return nil
+	}
+
+	usages, err := quotaUsage(tx, userID, site.ID, quota, time.Now())
+	if err != nil {
+		return err
+	}
+	// 先检查月配额，两者都超出时提示较晚的重置时间
+	for i := len(usages) - 1; i >= 0; i-- {
+		usage := usages[i]
+		name := "今日"
+		if usage.Period == "month" {
+			name = "本月"
+		}
+		resetAt := usage.ResetAt.Format("2006-01-02 15:04")
+		if paid && usage.DownloadLimit > 0 && usage.Downloads >= int64(usage.DownloadLimit) {
+			return &quotaExceededError{
+				message: fmt.Sprintf("%s付费下载次数已达上限（%d 次），将于 %s 重置", name, usage.DownloadLimit, resetAt),
+				resetAt: usage.ResetAt,
+			}
+		}
+		if usage.TrafficLimit > 0 && (usage.Traffic >= usage.TrafficLimit || usage.Traffic+size > usage.TrafficLimit) {
+			return &quotaExceededError{
+				message: fmt.Sprintf("%s下载流量已达上限（%d MB），将于 %s 重置", name, usage.TrafficLimit>>20, resetAt),
+				resetAt: usage.ResetAt,
+			}
+		}
+	}
+	return nil
+}
+
+// respondQuotaError 超出配额时返回 429 及重置时间，其他错误返回 500
+func respondQuotaError(c *gin.Context, err error) {
+	var quotaErr *quotaExceededError
+	if errors.As(err, &quotaErr) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": quotaErr.message, "code": http.StatusTooManyRequests, "resetAt": quotaErr.resetAt})
+		return
+	}
+	response.RespondWithError(c, http.StatusInternalServerError, "查询下载配额失败")
+}
+
+// recordDownload 写入下载记录，size 为实际传输的字节数，用于统计下载流量
+func recordDownload(siteID, userID uint, file *models.File, size int64) error {
+	return db.GetDB().Create(&models.DownloadLog{
+		SiteID: siteID,
+		UserID: userID,
+		FileID: file.ID,
+		Path:   file.Path,
+		Size:   size,
+	}).Error
+}
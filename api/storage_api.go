@@ -0,0 +1,190 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"qlist/db"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/response"
+	"qlist/pkg/secret"
+	"qlist/storage"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SiteStorageRequest 定义保存站点存储配置的请求体，密码和密钥留空表示不修改
+type SiteStorageRequest struct {
+	Driver      string `json:"driver"`
+	Endpoint    string `json:"endpoint"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Root        string `json:"root"`
+	Bucket      string `json:"bucket"`
+	Region      string `json:"region"`
+	AccessKey   string `json:"access_key"`
+	SecretKey   string `json:"secret_key"`
+	LinkExpires int    `json:"link_expires"`
+}
+
+// SiteStorageResponse 站点存储配置，凭据只返回是否已设置
+type SiteStorageResponse struct {
+	models.SiteStorage
+	HasPassword  bool `json:"hasPassword"`
+	HasSecretKey bool `json:"hasSecretKey"`
+}
+
+// GetSiteStorage godoc
+// @Summary 获取站点存储配置
+// @Description 获取当前站点单独配置的存储，未配置时使用配置文件中的存储
+// @Tags Storage
+// @Produce json
+// @Success 200 {object} SiteStorageResponse
+// @Router /api/storage [get]
+func GetSiteStorage(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var record models.SiteStorage
+	if err := db.GetDB().Where("site_id = ?", site.ID).First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.RespondWithError(c, http.StatusNotFound, "站点未单独配置存储，使用默认存储中以域名命名的子目录")
+			return
+		}
+		response.RespondWithError(c, http.StatusInternalServerError, "查询站点存储失败")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, newSiteStorageResponse(&record))
+}
+
+// SaveSiteStorage godoc
+// @Summary 保存站点存储配置
+// @Description 为当前站点配置存储，保存前会检查能否访问根路径，凭据加密后保存。本地存储的根目录须位于 site_storage_limits.local_base_dir 下，其他驱动的服务地址须在 site_storage_limits.allowed_endpoints 中
+// @Tags Storage
+// @Accept json
+// @Produce json
+// @Param storage body SiteStorageRequest true "存储配置"
+// @Success 200 {object} SiteStorageResponse
+// @Router /api/storage [post]
+func SaveSiteStorage(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var req SiteStorageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+	if req.Driver == "" {
+		response.RespondWithError(c, http.StatusBadRequest, "存储驱动不能为空")
+		return
+	}
+
+	var record models.SiteStorage
+	err := db.GetDB().Where("site_id = ?", site.ID).First(&record).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		response.RespondWithError(c, http.StatusInternalServerError, "查询站点存储失败")
+		return
+	}
+
+	record.SiteID = site.ID
+	record.Driver = req.Driver
+	record.Endpoint = strings.TrimSpace(req.Endpoint)
+	record.Username = req.Username
+	record.Root = strings.TrimSpace(req.Root)
+	record.Bucket = req.Bucket
+	record.Region = req.Region
+	record.AccessKey = req.AccessKey
+	record.LinkExpires = req.LinkExpires
+	if req.Password != "" {
+		if record.Password, err = secret.Encrypt(req.Password); err != nil {
+			response.RespondWithError(c, http.StatusInternalServerError, "加密存储凭据失败")
+			return
+		}
+	}
+	if req.SecretKey != "" {
+		if record.SecretKey, err = secret.Encrypt(req.SecretKey); err != nil {
+			response.RespondWithError(c, http.StatusInternalServerError, "加密存储凭据失败")
+			return
+		}
+	}
+
+	// 只允许运维限定的本地目录和服务地址，避免暴露主机文件或借服务端探测内网
+	cfg, err := storage.SiteStorageConfig(&record)
+	if err != nil {
+		log.Printf("读取站点 %d 的存储凭据失败: %v", site.ID, err)
+		response.RespondWithError(c, http.StatusInternalServerError, "读取存储凭据失败")
+		return
+	}
+	if err := storage.CheckSiteConfig(&cfg); err != nil {
+		response.RespondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	record.Root = cfg.Root
+
+	// 保存前确认配置可用，避免站点切换到无法访问的存储，具体错误只写日志，不返回给调用方
+	driver, err := storage.New(cfg)
+	if err != nil {
+		log.Printf("站点 %d 的存储配置无效: %v", site.ID, err)
+		response.RespondWithError(c, http.StatusBadRequest, "存储配置无效")
+		return
+	}
+	if _, err := driver.Stat(c.Request.Context(), "/"); err != nil {
+		log.Printf("站点 %d 无法访问存储: %v", site.ID, err)
+		response.RespondWithError(c, http.StatusBadRequest, "无法访问存储，请检查配置")
+		return
+	}
+
+	if err := db.GetDB().Save(&record).Error; err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "保存站点存储失败")
+		return
+	}
+	storage.Invalidate(site.ID)
+
+	response.RespondWithJSON(c, http.StatusOK, newSiteStorageResponse(&record))
+}
+
+// DeleteSiteStorage godoc
+// @Summary 删除站点存储配置
+// @Description 删除后当前站点恢复使用配置文件中的存储
+// @Tags Storage
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /api/storage [delete]
+func DeleteSiteStorage(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	result := db.GetDB().Unscoped().Where("site_id = ?", site.ID).Delete(&models.SiteStorage{})
+	if result.Error != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "删除站点存储失败")
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.RespondWithError(c, http.StatusNotFound, "站点未单独配置存储")
+		return
+	}
+	storage.Invalidate(site.ID)
+
+	response.RespondWithJSON(c, http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// newSiteStorageResponse 构造不含凭据的响应
+func newSiteStorageResponse(record *models.SiteStorage) SiteStorageResponse {
+	return SiteStorageResponse{
+		SiteStorage:  *record,
+		HasPassword:  record.Password != "",
+		HasSecretKey: record.SecretKey != "",
+	}
+}
@@ -0,0 +1,482 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"qlist/config"
+	"qlist/db"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/response"
+	"qlist/pricing"
+	"qlist/storage"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// errUploadTooLarge 上传内容超过大小上限
+	errUploadTooLarge = errors.New("文件超过大小上限")
+	// errUploadSizeMismatch 上传内容的大小与声明的 size 不一致
+	errUploadSizeMismatch = errors.New("文件大小与声明的不一致")
+)
+
+var (
+	uploadPathsMu sync.Mutex
+	// uploadPaths 正在写入的站点路径，同一路径同时只允许一个上传
+	uploadPaths = map[string]bool{}
+)
+
+// UploadLimits 站点的上传限制
+type UploadLimits struct {
+	MaxSize      int64    `json:"maxSize"`      // 单个文件的大小上限（字节），0 表示不限制
+	AllowedTypes []string `json:"allowedTypes"` // 允许上传的类型，为空表示不限制
+}
+
+// UploadLimitsRequest 定义保存站点上传限制的请求体，字段为空时使用配置文件中的默认值
+type UploadLimitsRequest struct {
+	MaxSize      int64    `json:"max_size"`
+	AllowedTypes []string `json:"allowed_types"`
+}
+
+// UploadResponse 上传成功后返回的文件记录和价格
+type UploadResponse struct {
+	File  *models.File   `json:"file"`
+	Price *pricing.Price `json:"price"`
+}
+
+// UploadFile godoc
+// @Summary 上传文件
+// @Description 以流的方式上传文件到站点存储并登记文件记录，不能覆盖已存在的文件，声明了 size 时内容大小须一致。站点管理员可同时设置积分。表单字段 path、name、points、description、size 需放在文件之前
+// @Tags Files
+// @Accept multipart/form-data
+// @Produce json
+// @Param path formData string false "目标目录，默认为 /"
+// @Param name formData string false "文件名，默认使用上传的文件名"
+// @Param points formData int false "下载所需积分，仅站点管理员可设置"
+// @Param description formData string false "积分描述"
+// @Param size formData int false "文件大小（字节），用于提前检查大小上限，与实际内容不一致时上传失败"
+// @Param file formData file true "文件"
+// @Success 200 {object} UploadResponse
+// @Router /api/files/upload [post]
+func UploadFile(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	limits := siteUploadLimits(site)
+	if limits.MaxSize > 0 {
+		// 为表单字段预留余量，文件本身的大小由 limitedReader 精确限制
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxSize+1<<20)
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		response.RespondWithError(c, http.StatusBadRequest, "请求必须为 multipart/form-data")
+		return
+	}
+
+	// 依次读取表单字段，遇到文件时直接写入存储，不在内存中缓冲
+	fields := map[string]string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			response.RespondWithError(c, http.StatusBadRequest, "缺少上传文件")
+			return
+		}
+		if err != nil {
+			response.RespondWithError(c, http.StatusBadRequest, "读取上传数据失败")
+			return
+		}
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			part.Close()
+			if err != nil {
+				response.RespondWithError(c, http.StatusBadRequest, "读取上传数据失败")
+				return
+			}
+			fields[part.FormName()] = string(value)
+			continue
+		}
+
+		uploadPart(c, site, limits, fields, part)
+		part.Close()
+		return
+	}
+}
+
+// uploadPart 校验并写入上传的文件，成功后登记文件记录和积分配置
+func uploadPart(c *gin.Context, site *models.Site, limits UploadLimits, fields map[string]string, part *multipart.Part) {
+	name := strings.TrimSpace(fields["name"])
+	if name == "" {
+		name = part.FileName()
+	}
+
+	size := int64(-1)
+	if value := fields["size"]; value != "" {
+		var err error
+		if size, err = strconv.ParseInt(value, 10, 64); err != nil || size < 0 {
+			response.RespondWithError(c, http.StatusBadRequest, "无效的文件大小")
+			return
+		}
+	}
+
+	// 上传者不能为文件定价，只有站点管理员可以设置积分
+	var points *int
+	if value := fields["points"]; value != "" {
+		if !canPriceUpload(c) {
+			response.RespondWithError(c, http.StatusForbidden, "只有站点管理员可以设置积分")
+			return
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			response.RespondWithError(c, http.StatusBadRequest, "无效的积分值")
+			return
+		}
+		points = &n
+	}
+
+	target, err := newUploadTarget(limits, fields["path"], name, part.Header.Get("Content-Type"), size, points)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	target.Description = fields["description"]
+
+	driver, err := middleware.GetStorageFromContext(c)
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "获取站点存储失败")
+		return
+	}
+	release, err := reserveUploadPath(c.Request.Context(), driver, site.ID, target.Path)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	defer release()
+
+	// 存储驱动在读取出错时放弃写入
+	body := &limitedReader{r: part, limit: limits.MaxSize, size: size}
+	err = driver.Put(c.Request.Context(), target.Path, body, size, target.ContentType)
+	if err == nil {
+		// 按声明的大小写入的驱动不会读到多余的内容，写入后确认请求体已读完
+		err = body.verify()
+		if err != nil {
+			removeUpload(driver, target.Path)
+		}
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.Is(err, errUploadTooLarge) || errors.As(err, &maxBytesErr) {
+			response.RespondWithError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("文件超过大小上限 %d 字节", limits.MaxSize))
+			return
+		}
+		if errors.Is(err, errUploadSizeMismatch) {
+			response.RespondWithError(c, http.StatusBadRequest, errUploadSizeMismatch.Error())
+			return
+		}
+		log.Printf("写入存储失败 %s: %v", target.Path, err)
+		response.RespondWithError(c, http.StatusBadGateway, "写入存储失败")
+		return
+	}
+	target.Size = body.n
+
+	result, err := recordUpload(site.ID, target)
+	if err != nil {
+		// 未登记的文件不保留，客户端可以重新上传
+		removeUpload(driver, target.Path)
+		respondUploadError(c, err)
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, result)
+}
+
+// uploadTarget 校验通过的上传目标
+type uploadTarget struct {
+	Path        string
+	Name        string
+	ContentType string
+	Size        int64 // 大小未知时为 -1
+	Points      *int
+	Description string
+}
+
+// uploadError 上传失败时返回给客户端的状态码和错误信息
+type uploadError struct {
+	status  int
+	message string
+}
+
+func (e *uploadError) Error() string {
+	return e.message
+}
+
+// respondUploadError 按 uploadError 中的状态码响应，其他错误按服务器错误处理
+func respondUploadError(c *gin.Context, err error) {
+	var uploadErr *uploadError
+	if errors.As(err, &uploadErr) {
+		response.RespondWithError(c, uploadErr.status, uploadErr.message)
+		return
+	}
+	log.Printf("上传失败: %v", err)
+	response.RespondWithError(c, http.StatusInternalServerError, "上传失败")
+}
+
+// reserveUploadPath 锁定上传的目标路径并确认其在存储中不存在，返回的函数用于在上传结束后解锁
+// 同一路径的并发上传只有一个能通过，避免先检查后写入之间被其他上传覆盖
+func reserveUploadPath(ctx context.Context, driver storage.Driver, siteID uint, filePath string) (func(), error) {
+	key := fmt.Sprintf("%d:%s", siteID, filePath)
+	uploadPathsMu.Lock()
+	if uploadPaths[key] {
+		uploadPathsMu.Unlock()
+		return nil, &uploadError{http.StatusConflict, "该路径正在上传"}
+	}
+	uploadPaths[key] = true
+	uploadPathsMu.Unlock()
+
+	release := func() {
+		uploadPathsMu.Lock()
+		delete(uploadPaths, key)
+		uploadPathsMu.Unlock()
+	}
+	if err := checkUploadPath(ctx, driver, filePath); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// removeUpload 删除写入后未能登记的文件，删除失败只记录日志
+func removeUpload(driver storage.Driver, filePath string) {
+	if err := driver.Delete(context.Background(), filePath); err != nil {
+		log.Printf("删除未登记的上传文件失败 %s: %v", filePath, err)
+	}
+}
+
+// checkUploadPath 确认目标路径在存储中不存在，上传不能覆盖已有的文件或目录
+func checkUploadPath(ctx context.Context, driver storage.Driver, filePath string) error {
+	_, err := driver.Stat(ctx, filePath)
+	if err == nil {
+		return &uploadError{http.StatusConflict, "文件已存在"}
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("查询存储文件失败 %s: %v", filePath, err)
+		return &uploadError{http.StatusBadGateway, "查询存储文件失败"}
+	}
+	return nil
+}
+
+// canPriceUpload 判断当前上传者能否设置积分，使用 API Key 或站点管理员时可以
+func canPriceUpload(c *gin.Context) bool {
+	user, ok := middleware.GetUserFromContext(c)
+	return !ok || user.IsAdmin
+}
+
+// newUploadTarget 校验文件名、目标目录、类型、大小和积分，dir 为目标目录
+func newUploadTarget(limits UploadLimits, dir, name, contentType string, size int64, points *int) (*uploadTarget, error) {
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), "\\", "/"))
+	if name == "" || name == "." || name == "/" {
+		return nil, &uploadError{http.StatusBadRequest, "文件名不能为空"}
+	}
+
+	filePath := pricing.NormalizePath(path.Join("/", dir, name))
+	if isHiddenPath(filePath) {
+		return nil, &uploadError{http.StatusBadRequest, "不能上传到隐藏路径"}
+	}
+
+	// 客户端未声明类型时按扩展名推断
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = mime.TypeByExtension(path.Ext(name))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if !limits.allows(name, contentType) {
+		return nil, &uploadError{http.StatusUnsupportedMediaType, "不允许上传该类型的文件"}
+	}
+
+	if limits.MaxSize > 0 && size > limits.MaxSize {
+		return nil, &uploadError{http.StatusRequestEntityTooLarge, fmt.Sprintf("文件超过大小上限 %d 字节", limits.MaxSize)}
+	}
+	if points != nil && *points < 0 {
+		return nil, &uploadError{http.StatusBadRequest, "无效的积分值"}
+	}
+
+	return &uploadTarget{Path: filePath, Name: name, ContentType: contentType, Size: size, Points: points}, nil
+}
+
+// recordUpload 文件写入存储后登记文件记录，设置了积分时保存积分配置，返回文件和生效的价格
+func recordUpload(siteID uint, target *uploadTarget) (*UploadResponse, error) {
+	file, err := RecordFileUpload(siteID, target.Path, target.Name, target.Size, target.ContentType)
+	if err != nil {
+		return nil, &uploadError{http.StatusInternalServerError, "登记文件失败"}
+	}
+
+	if target.Points != nil {
+		config := models.PointConfig{
+			SiteID:      siteID,
+			FileID:      &file.ID,
+			Path:        file.Path,
+			Points:      *target.Points,
+			Description: target.Description,
+		}
+		if err := savePointConfig(&config); err != nil {
+			return nil, &uploadError{http.StatusInternalServerError, "保存积分配置失败"}
+		}
+	}
+
+	resolver, err := pricing.NewResolver(siteID)
+	if err != nil {
+		return nil, &uploadError{http.StatusInternalServerError, "查询定价规则失败"}
+	}
+	price, err := resolver.ResolveFile(file)
+	if err != nil {
+		return nil, &uploadError{http.StatusInternalServerError, "查询文件积分配置失败"}
+	}
+	return &UploadResponse{File: file, Price: price}, nil
+}
+
+// GetUploadLimits godoc
+// @Summary 获取上传限制
+// @Description 获取当前站点生效的上传大小和类型限制
+// @Tags Files
+// @Produce json
+// @Success 200 {object} UploadLimits
+// @Router /api/files/upload/limits [get]
+func GetUploadLimits(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, siteUploadLimits(site))
+}
+
+// SaveUploadLimits godoc
+// @Summary 保存上传限制
+// @Description 设置当前站点的上传大小和类型限制，字段为空时使用配置文件中的默认值
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param limits body UploadLimitsRequest true "上传限制"
+// @Success 200 {object} UploadLimits
+// @Router /api/files/upload/limits [post]
+func SaveUploadLimits(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var req UploadLimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.MaxSize < 0 {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+
+	var types []string
+	for _, t := range req.AllowedTypes {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			types = append(types, t)
+		}
+	}
+
+	if err := db.GetDB().Model(site).Updates(map[string]interface{}{
+		"max_upload_size":      req.MaxSize,
+		"allowed_upload_types": strings.Join(types, ","),
+	}).Error; err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "保存上传限制失败")
+		return
+	}
+	site.MaxUploadSize = req.MaxSize
+	site.AllowedUploadTypes = strings.Join(types, ",")
+
+	response.RespondWithJSON(c, http.StatusOK, siteUploadLimits(site))
+}
+
+// siteUploadLimits 返回站点生效的上传限制，站点未设置的项使用配置文件中的默认值
+func siteUploadLimits(site *models.Site) UploadLimits {
+	limits := UploadLimits{
+		MaxSize:      config.Instance.Upload.MaxSize,
+		AllowedTypes: config.Instance.Upload.AllowedTypes,
+	}
+	if site.MaxUploadSize > 0 {
+		limits.MaxSize = site.MaxUploadSize
+	}
+	if site.AllowedUploadTypes != "" {
+		limits.AllowedTypes = strings.Split(site.AllowedUploadTypes, ",")
+	}
+	return limits
+}
+
+// allows 判断文件是否为允许上传的类型
+// .zip 按扩展名匹配，image/* 按类型前缀匹配，其余按完整类型匹配
+func (l UploadLimits) allows(name, contentType string) bool {
+	if len(l.AllowedTypes) == 0 {
+		return true
+	}
+	ext := strings.ToLower(path.Ext(name))
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, t := range l.AllowedTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+		switch {
+		case strings.HasPrefix(t, "."):
+			if ext == t {
+				return true
+			}
+		case strings.HasSuffix(t, "/*"):
+			if strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")) {
+				return true
+			}
+		case mediaType == t:
+			return true
+		}
+	}
+	return false
+}
+
+// limitedReader 统计读取的字节数，超过上限时返回 errUploadTooLarge，与声明的大小不一致时返回 errUploadSizeMismatch
+type limitedReader struct {
+	r     io.Reader
+	limit int64 // 0 表示不限制
+	size  int64 // 声明的大小，-1 表示未知
+	n     int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.limit > 0 && l.n > l.limit {
+		return n, errUploadTooLarge
+	}
+	if l.size >= 0 && (l.n > l.size || err == io.EOF && l.n != l.size) {
+		return n, errUploadSizeMismatch
+	}
+	return n, err
+}
+
+// verify 确认内容已全部读取且大小与声明的一致
+func (l *limitedReader) verify() error {
+	if l.size < 0 {
+		return nil
+	}
+	if _, err := l.Read(make([]byte, 1)); err != io.EOF {
+		if err == nil {
+			err = errUploadSizeMismatch
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"qlist/db"
+	"qlist/middleware"
+	"qlist/models"
+	"qlist/pkg/response"
+	"qlist/upload"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateUploadSessionRequest 定义创建分片上传会话的请求体
+type CreateUploadSessionRequest struct {
+	Path        string `json:"path"` // 目标目录，默认为 /
+	Name        string `json:"name" binding:"required"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	Points      *int   `json:"points"` // 仅站点管理员可设置
+	Description string `json:"description"`
+}
+
+// UploadSessionResponse 分片上传会话的状态，客户端从 offset 处继续上传
+type UploadSessionResponse struct {
+	models.UploadSession
+	ChunkSize int `json:"chunkSize"` // 建议的分片大小
+}
+
+// CreateUploadSession godoc
+// @Summary 创建分片上传会话
+// @Description 大文件分片上传的第一步，校验文件名、类型和大小并确认目标文件不存在后返回会话 ID。之后通过 PUT 上传分片，全部上传后提交
+// @Tags Files
+// @Accept json
+// @Produce json
+// @Param session body CreateUploadSessionRequest true "上传文件信息"
+// @Success 200 {object} UploadSessionResponse
+// @Router /api/files/uploads [post]
+func CreateUploadSession(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+
+	var req CreateUploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Size < 0 {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+
+	if req.Points != nil && !canPriceUpload(c) {
+		response.RespondWithError(c, http.StatusForbidden, "只有站点管理员可以设置积分")
+		return
+	}
+	target, err := newUploadTarget(siteUploadLimits(site), req.Path, req.Name, req.ContentType, req.Size, req.Points)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	driver, err := middleware.GetStorageFromContext(c)
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "获取站点存储失败")
+		return
+	}
+	if err := checkUploadPath(c.Request.Context(), driver, target.Path); err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	session := models.UploadSession{
+		SiteID:      site.ID,
+		UserID:      uploadUserID(c),
+		Path:        target.Path,
+		Name:        target.Name,
+		Size:        req.Size,
+		ContentType: target.ContentType,
+		Points:      target.Points,
+		Description: req.Description,
+	}
+	if err := upload.Create(&session); err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "创建上传会话失败")
+		return
+	}
+
+	response.RespondWithJSON(c, http.StatusOK, UploadSessionResponse{UploadSession: session, ChunkSize: upload.ChunkSize})
+}
+
+// GetUploadSession godoc
+// @Summary 查询分片上传进度
+// @Description 返回已接收的字节数，连接中断后客户端据此从断点继续上传
+// @Tags Files
+// @Produce json
+// @Param id path string true "会话ID"
+// @Success 200 {object} UploadSessionResponse
+// @Router /api/files/uploads/{id} [get]
+func GetUploadSession(c *gin.Context) {
+	session, ok := loadUploadSession(c)
+	if !ok {
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, UploadSessionResponse{UploadSession: *session, ChunkSize: upload.ChunkSize})
+}
+
+// UploadChunk godoc
+// @Summary 上传分片
+// @Description 请求体为分片的原始数据，Upload-Offset 请求头（或 offset 参数）为分片在文件中的起始位置，必须等于已接收的字节数。偏移量不一致时返回 409 和当前进度
+// @Tags Files
+// @Accept octet-stream
+// @Produce json
+// @Param id path string true "会话ID"
+// @Param Upload-Offset header int true "分片起始位置"
+// @Success 200 {object} UploadSessionResponse
+// @Router /api/files/uploads/{id} [put]
+func UploadChunk(c *gin.Context) {
+	session, ok := loadUploadSession(c)
+	if !ok {
+		return
+	}
+
+	value := c.GetHeader("Upload-Offset")
+	if value == "" {
+		value = c.Query("offset")
+	}
+	offset, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || offset < 0 {
+		response.RespondWithError(c, http.StatusBadRequest, "无效的分片偏移量")
+		return
+	}
+
+	err = upload.Append(c.Request.Context(), session, offset, c.Request.Body)
+	switch {
+	case err == nil:
+		response.RespondWithJSON(c, http.StatusOK, UploadSessionResponse{UploadSession: *session, ChunkSize: upload.ChunkSize})
+	case errors.Is(err, upload.ErrOffsetMismatch):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": http.StatusConflict, "offset": session.Offset})
+	case errors.Is(err, upload.ErrBusy):
+		response.RespondWithError(c, http.StatusConflict, err.Error())
+	case errors.Is(err, upload.ErrTooLarge):
+		response.RespondWithError(c, http.StatusRequestEntityTooLarge, err.Error())
+	default:
+		// 连接中断时已写入的数据会保留，客户端查询进度后续传
+		response.RespondWithError(c, http.StatusInternalServerError, "写入分片失败")
+	}
+}
+
+// CommitUpload godoc
+// @Summary 提交分片上传
+// @Description 数据全部接收后写入站点存储，登记文件记录，创建会话时设置了积分则同时定价
+// @Tags Files
+// @Produce json
+// @Param id path string true "会话ID"
+// @Success 200 {object} UploadResponse
+// @Router /api/files/uploads/{id}/commit [post]
+func CommitUpload(c *gin.Context) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return
+	}
+	session, ok := loadUploadSession(c)
+	if !ok {
+		return
+	}
+
+	driver, err := middleware.GetStorageFromContext(c)
+	if err != nil {
+		response.RespondWithError(c, http.StatusInternalServerError, "获取站点存储失败")
+		return
+	}
+
+	// 写入存储或登记失败时保留会话，客户端可以重新提交
+	var result *UploadResponse
+	err = upload.Commit(session, func(r io.Reader) error {
+		// 创建会话后目标路径可能已被其他上传占用
+		release, err := reserveUploadPath(c.Request.Context(), driver, site.ID, session.Path)
+		if err != nil {
+			return err
+		}
+		defer release()
+		if err := driver.Put(c.Request.Context(), session.Path, r, session.Size, session.ContentType); err != nil {
+			log.Printf("写入存储失败 %s: %v", session.Path, err)
+			return &uploadError{http.StatusBadGateway, "写入存储失败"}
+		}
+		result, err = recordUpload(site.ID, &uploadTarget{
+			Path:        session.Path,
+			Name:        session.Name,
+			ContentType: session.ContentType,
+			Size:        session.Size,
+			Points:      session.Points,
+			Description: session.Description,
+		})
+		if err != nil {
+			// 删除未登记的文件，重新提交时目标路径仍然可用
+			removeUpload(driver, session.Path)
+		}
+		return err
+	})
+	switch {
+	case err == nil:
+		response.RespondWithJSON(c, http.StatusOK, result)
+	case errors.Is(err, upload.ErrIncomplete):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": http.StatusConflict, "offset": session.Offset})
+	case errors.Is(err, upload.ErrBusy):
+		response.RespondWithError(c, http.StatusConflict, err.Error())
+	default:
+		respondUploadError(c, err)
+	}
+}
+
+// CancelUpload godoc
+// @Summary 取消分片上传
+// @Description 删除上传会话和已接收的数据
+// @Tags Files
+// @Produce json
+// @Param id path string true "会话ID"
+// @Success 200 {object} map[string]string
+// @Router /api/files/uploads/{id} [delete]
+func CancelUpload(c *gin.Context) {
+	session, ok := loadUploadSession(c)
+	if !ok {
+		return
+	}
+	if err := upload.Remove(session); err != nil {
+		if errors.Is(err, upload.ErrBusy) {
+			response.RespondWithError(c, http.StatusConflict, err.Error())
+			return
+		}
+		response.RespondWithError(c, http.StatusInternalServerError, "取消上传失败")
+		return
+	}
+	response.RespondWithJSON(c, http.StatusOK, gin.H{"message": "已取消上传"})
+}
+
+// loadUploadSession 查询当前站点和用户的上传会话，不存在或已过期时直接响应 404
+func loadUploadSession(c *gin.Context) (*models.UploadSession, bool) {
+	site, exists := middleware.GetSiteFromContext(c)
+	if !exists {
+		response.RespondWithError(c, http.StatusInternalServerError, "无法获取站点信息")
+		return nil, false
+	}
+
+	var session models.UploadSession
+	err := db.GetDB().Where("id = ? AND site_id = ? AND user_id = ?", c.Param("id"), site.ID, uploadUserID(c)).
+		Where("expires_at > ?", time.Now()).
+		First(&session).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.RespondWithError(c, http.StatusNotFound, "上传会话不存在或已过期")
+			return nil, false
+		}
+		response.RespondWithError(c, http.StatusInternalServerError, "查询上传会话失败")
+		return nil, false
+	}
+	return &session, true
+}
+
+// uploadUserID 返回当前上传者的用户ID，使用 API Key 时为 0
+func uploadUserID(c *gin.Context) uint {
+	if user, ok := middleware.GetUserFromContext(c); ok {
+		return user.ID
+	}
+	return 0
+}
@@ -0,0 +1,291 @@
+package billing
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"qlist/db"
+	"qlist/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OrderTTL 订单创建后等待支付的时间
+const OrderTTL = 30 * time.Minute
+
+var (
+	// ErrPackageUnavailable 套餐不存在或已停用
+	ErrPackageUnavailable = errors.New("充值套餐不存在或已停用")
+	// ErrOrderNotFound 订单不存在
+	ErrOrderNotFound = errors.New("订单不存在")
+	// ErrInvalidStatus 订单当前的状态不允许此操作
+	ErrInvalidStatus = errors.New("订单状态不允许此操作")
+	// ErrAmountMismatch 实际支付的金额与订单金额不一致
+	ErrAmountMismatch = errors.New("支付金额与订单金额不一致")
+	// ErrInsufficientPoints 用户剩余积分不足以扣回充值的积分
+	ErrInsufficientPoints = errors.New("用户剩余积分不足，无法退款")
+)
+
+// CreateOrder 按套餐为用户创建待支付的订单，订单记录下单时的价格和积分
+func CreateOrder(siteID, userID, packageID uint) (*models.Order, error) {
+	var pkg models.PointPackage
+	err := db.GetDB().Where("id = ? AND site_id = ? AND enabled = ?", packageID, siteID, true).First(&pkg).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrPackageUnavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	orderNo, err := newOrderNo()
+	if err != nil {
+		return nil, err
+	}
+	order := models.Order{
+		OrderNo:     orderNo,
+		SiteID:      siteID,
+		UserID:      userID,
+		PackageID:   pkg.ID,
+		Subject:     pkg.Name,
+		AmountCents: pkg.PriceCents,
+		Points:      pkg.Points,
+		Status:      models.OrderCreated,
+		ExpiresAt:   time.Now().Add(OrderTTL),
+	}
+	if err := db.GetDB().Create(&order).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// FindOrder 按订单号查询订单
+func FindOrder(orderNo string) (*models.Order, error) {
+	var order models.Order
+	err := db.GetDB().Where("order_no = ?", orderNo).First(&order).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// MarkPaid 将订单标记为已支付，amountCents 为实际支付的金额，之后需调用 Fulfill 发放积分
+// 过期后才到账的支付同样接受，支付渠道重复通知同一笔交易时直接返回订单
+func MarkPaid(orderNo, payMethod, transactionID string, amountCents int64) (*models.Order, error) {
+	order, err := FindOrder(orderNo)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status != models.OrderCreated && order.Status != models.OrderExpired {
+		if order.PaidAt != nil && order.TransactionID == transactionID {
+			return order, nil
+		}
+		return nil, ErrInvalidStatus
+	}
+	if amountCents != order.AmountCents {
+		return nil, ErrAmountMismatch
+	}
+
+	now := time.Now()
+	result := db.GetDB().Model(&models.Order{}).
+		Where("id = ? AND status IN ?", order.ID, []string{models.OrderCreated, models.OrderExpired}).
+		Updates(map[string]interface{}{
+			"status":         models.OrderPaid,
+			"pay_method":     payMethod,
+			"transaction_id": transactionID,
+			"paid_at":        now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// 并发的重复通知已先一步更新了订单
+		if order, err = FindOrder(orderNo); err != nil {
+			return nil, err
+		}
+		if order.PaidAt != nil && order.TransactionID == transactionID {
+			return order, nil
+		}
+		return nil, ErrInvalidStatus
+	}
+	return FindOrder(orderNo)
+}
+
+// Fulfill 为已支付的订单发放积分并写入 recharge 积分日志
+// 订单状态、用户积分和日志在同一事务中更新，已发放过的订单直接返回，不会重复加积分
+func Fulfill(orderNo string) (*models.Order, error) {
+	order, err := FindOrder(orderNo)
+	if err != nil {
+		return nil, err
+	}
+	switch order.Status {
+	case models.OrderFulfilled:
+		return order, nil
+	case models.OrderPaid:
+	default:
+		return nil, ErrInvalidStatus
+	}
+
+	tx := db.GetDB().Begin()
+	// 以状态作为条件更新，并发发放时只有一个事务能成功
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, models.OrderPaid).
+		Updates(map[string]interface{}{"status": models.OrderFulfilled, "fulfilled_at": time.Now()})
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		if order, err = FindOrder(orderNo); err != nil {
+			return nil, err
+		}
+		if order.Status == models.OrderFulfilled {
+			return order, nil
+		}
+		return nil, ErrInvalidStatus
+	}
+
+	result = tx.Model(&models.User{}).
+		Where("id = ? AND site_id = ?", order.UserID, order.SiteID).
+		Update("points", gorm.Expr("points + ?", order.Points))
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, fmt.Errorf("订单 %s 的用户不存在", orderNo)
+	}
+
+	pointLog := models.PointLog{
+		UserID:  order.UserID,
+		SiteID:  order.SiteID,
+		Points:  order.Points,
+		Action:  "recharge",
+		Details: fmt.Sprintf("充值订单 %s: %s", order.OrderNo, order.Subject),
+	}
+	if err := tx.Create(&pointLog).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).Update("point_log_id", pointLog.ID).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return FindOrder(orderNo)
+}
+
+// Refund 将订单标记为已退款，已发放的积分从用户余额中扣回，余额不足时返回 ErrInsufficientPoints
+// 只更新本地订单状态，退款资金需通过支付渠道另行处理
+func Refund(orderNo string) (*models.Order, error) {
+	order, err := FindOrder(orderNo)
+	if err != nil {
+		return nil, err
+	}
+	switch order.Status {
+	case models.OrderRefunded:
+		return order, nil
+	case models.OrderPaid, models.OrderFulfilled:
+	default:
+		return nil, ErrInvalidStatus
+	}
+
+	tx := db.GetDB().Begin()
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, order.Status).
+		Updates(map[string]interface{}{"status": models.OrderRefunded, "refunded_at": time.Now()})
+	if result.Error != nil {
+		tx.Rollback()
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, ErrInvalidStatus
+	}
+
+	if order.Status == models.OrderFulfilled {
+		result = tx.Model(&models.User{}).
+			Where("id = ? AND site_id = ? AND points >= ?", order.UserID, order.SiteID, order.Points).
+			Update("points", gorm.Expr("points - ?", order.Points))
+		if result.Error != nil {
+			tx.Rollback()
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			tx.Rollback()
+			return nil, ErrInsufficientPoints
+		}
+
+		pointLog := models.PointLog{
+			UserID:  order.UserID,
+			SiteID:  order.SiteID,
+			Points:  -order.Points,
+			Action:  "recharge",
+			Details: fmt.Sprintf("充值订单 %s 退款", order.OrderNo),
+		}
+		if err := tx.Create(&pointLog).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return FindOrder(orderNo)
+}
+
+// RecordPaymentException 记录无法入账的支付通知，同一笔交易的重复通知只记录一次
+func RecordPaymentException(orderNo, payMethod, transactionID string, amountCents int64, reason error) error {
+	exception := models.PaymentException{
+		OrderNo:       orderNo,
+		PayMethod:     payMethod,
+		TransactionID: transactionID,
+		AmountCents:   amountCents,
+		Reason:        reason.Error(),
+	}
+	if order, err := FindOrder(orderNo); err == nil {
+		exception.SiteID = order.SiteID
+	}
+	return db.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&exception).Error
+}
+
+// ExpireOrders 将超过支付时间的待支付订单标记为已过期，返回更新的订单数
+func ExpireOrders() (int64, error) {
+	result := db.GetDB().Model(&models.Order{}).
+		Where("status = ? AND expires_at < ?", models.OrderCreated, time.Now()).
+		Update("status", models.OrderExpired)
+	return result.RowsAffected, result.Error
+}
+
+// StartExpirer 定期将超时未支付的订单标记为已过期
+func StartExpirer(interval time.Duration) {
+	go func() {
+		for {
+			if _, err := ExpireOrders(); err != nil {
+				log.Printf("更新过期订单失败: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// newOrderNo 生成订单号：下单时间加 8 位随机数字，共 22 位
+func newOrderNo() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1e8))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%08d", time.Now().Format("20060102150405"), n.Int64()), nil
+}
@@ -0,0 +1,232 @@
+package billing
+
+import (
+	"errors"
+	"path/filepath"
+	"qlist/config"
+	"qlist/db"
+	"qlist/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testPriceCents = 1000
+	testPoints     = 100
+)
+
+// orderTestEnv 订单测试的站点、用户和套餐
+type orderTestEnv struct {
+	site models.Site
+	user models.User
+	pkg  models.PointPackage
+}
+
+// newOrderTestEnv 使用临时 SQLite 数据库创建站点、积分为 0 的用户和一个启用的充值套餐
+func newOrderTestEnv(t *testing.T) *orderTestEnv {
+	config.Instance = config.AppConfig{
+		DBType:    "sqlite",
+		DBConn:    filepath.Join(t.TempDir(), "qlist.db") + "?_busy_timeout=10000&_txlock=immediate",
+		JWTSecret: "test-secret",
+	}
+	if err := db.InitDB(); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+
+	env := &orderTestEnv{site: models.Site{Name: "test", Domain: "example.com"}}
+	if err := db.GetDB().Create(&env.site).Error; err != nil {
+		t.Fatal(err)
+	}
+	env.user = models.User{SiteID: env.site.ID, Username: "u@example.com", Provider: "local"}
+	if err := db.GetDB().Create(&env.user).Error; err != nil {
+		t.Fatal(err)
+	}
+	env.pkg = models.PointPackage{SiteID: env.site.ID, Name: "100 积分", PriceCents: testPriceCents, Points: testPoints, Enabled: true}
+	if err := db.GetDB().Create(&env.pkg).Error; err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+// newOrder 创建待支付的订单
+func (env *orderTestEnv) newOrder(t *testing.T) *models.Order {
+	order, err := CreateOrder(env.site.ID, env.user.ID, env.pkg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+// credited 返回用户的充值日志条数和当前积分
+func (env *orderTestEnv) credited(t *testing.T) (int64, int) {
+	var updated models.User
+	if err := db.GetDB().First(&updated, env.user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var logs int64
+	if err := db.GetDB().Model(&models.PointLog{}).
+		Where("user_id = ? AND action = ?", env.user.ID, "recharge").
+		Count(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+	return logs, updated.Points
+}
+
+// TestMarkPaid 支付通知按订单状态和实际支付金额决定能否入账
+func TestMarkPaid(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, order *models.Order) // 收到支付通知前对订单的处理
+		orderNo string                                  // 非空时代替订单号，模拟未知订单
+		amount  int64
+		wantErr error
+	}{
+		{
+			name:   "待支付订单",
+			amount: testPriceCents,
+		},
+		{
+			name: "过期后才到账",
+			prepare: func(t *testing.T, order *models.Order) {
+				if err := db.GetDB().Model(order).Updates(map[string]interface{}{
+					"expires_at": time.Now().Add(-time.Minute),
+				}).Error; err != nil {
+					t.Fatal(err)
+				}
+				if n, err := ExpireOrders(); err != nil || n != 1 {
+					t.Fatalf("过期订单 %d 个: %v", n, err)
+				}
+			},
+			amount: testPriceCents,
+		},
+		{
+			name:    "金额不一致",
+			amount:  testPriceCents - 1,
+			wantErr: ErrAmountMismatch,
+		},
+		{
+			name: "已退款的订单再次支付",
+			prepare: func(t *testing.T, order *models.Order) {
+				if _, err := MarkPaid(order.OrderNo, "manual", "first", testPriceCents); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := Refund(order.OrderNo); err != nil {
+					t.Fatal(err)
+				}
+			},
+			amount:  testPriceCents,
+			wantErr: ErrInvalidStatus,
+		},
+		{
+			name: "已支付的订单收到另一笔交易",
+			prepare: func(t *testing.T, order *models.Order) {
+				if _, err := MarkPaid(order.OrderNo, "manual", "first", testPriceCents); err != nil {
+					t.Fatal(err)
+				}
+			},
+			amount:  testPriceCents,
+			wantErr: ErrInvalidStatus,
+		},
+		{
+			name:    "订单不存在",
+			orderNo: "00000000000000000000",
+			amount:  testPriceCents,
+			wantErr: ErrOrderNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newOrderTestEnv(t)
+			order := env.newOrder(t)
+			if tt.prepare != nil {
+				tt.prepare(t, order)
+			}
+			orderNo := order.OrderNo
+			if tt.orderNo != "" {
+				orderNo = tt.orderNo
+			}
+
+			paid, err := MarkPaid(orderNo, "wechat_native", "txn-1", tt.amount)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				if tt.orderNo == "" {
+					if current, _ := FindOrder(orderNo); current.TransactionID == "txn-1" {
+						t.Fatalf("被拒绝的支付不应修改订单: %+v", current)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if paid.Status != models.OrderPaid || paid.TransactionID != "txn-1" || paid.PaidAt == nil {
+				t.Fatalf("订单未标记为已支付: %+v", paid)
+			}
+		})
+	}
+}
+
+// TestDuplicateNotification 支付渠道重复通知同一笔交易时只发放一次积分
+func TestDuplicateNotification(t *testing.T) {
+	env := newOrderTestEnv(t)
+	order := env.newOrder(t)
+
+	for i := 0; i < 3; i++ {
+		if _, err := MarkPaid(order.OrderNo, "wechat_native", "txn-1", testPriceCents); err != nil {
+			t.Fatalf("第 %d 次通知: %v", i+1, err)
+		}
+		fulfilled, err := Fulfill(order.OrderNo)
+		if err != nil {
+			t.Fatalf("第 %d 次通知: %v", i+1, err)
+		}
+		if fulfilled.Status != models.OrderFulfilled {
+			t.Fatalf("订单状态 %s，期望 %s", fulfilled.Status, models.OrderFulfilled)
+		}
+	}
+
+	logs, points := env.credited(t)
+	if logs != 1 || points != testPoints {
+		t.Fatalf("充值日志 %d 条、积分 %d，期望 1 条、%d", logs, points, testPoints)
+	}
+}
+
+// TestConcurrentFulfill 并发发放同一订单的积分时只发放一次
+func TestConcurrentFulfill(t *testing.T) {
+	const requests = 10
+
+	env := newOrderTestEnv(t)
+	order := env.newOrder(t)
+	if _, err := MarkPaid(order.OrderNo, "wechat_native", "txn-1", testPriceCents); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := Fulfill(order.OrderNo); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		t.Fatalf("并发发放失败: %v", errs)
+	}
+	logs, points := env.credited(t)
+	if logs != 1 || points != testPoints {
+		t.Fatalf("充值日志 %d 条、积分 %d，期望 1 条、%d", logs, points, testPoints)
+	}
+}
@@ -0,0 +1,372 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"path"
+	"qlist/db"
+	"qlist/models"
+	"qlist/storage"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// maxDepth 遍历的最大目录层级，超过的目录跳过，防止符号链接形成的环导致无限递归
+const maxDepth = 32
+
+// ErrRunning 站点已有同步任务在运行
+var ErrRunning = errors.New("目录同步正在进行中")
+
+// Progress 站点目录同步的进度，同步结束后保留最近一次的结果
+type Progress struct {
+	SiteID     uint       `json:"siteId"`
+	Running    bool       `json:"running"`
+	Current    string     `json:"current,omitempty"` // 正在遍历的目录
+	Dirs       int        `json:"dirs"`
+	Files      int        `json:"files"`
+	Created    int        `json:"created"`
+	Updated    int        `json:"updated"`
+	Renamed    int        `json:"renamed"`
+	Deleted    int        `json:"deleted"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+var (
+	mu       sync.Mutex
+	progress = map[uint]*Progress{}
+)
+
+// Status 返回站点最近一次同步的进度，从未同步过时返回 nil
+func Status(siteID uint) *Progress {
+	mu.Lock()
+	defer mu.Unlock()
+	if p, ok := progress[siteID]; ok {
+		snapshot := *p
+		return &snapshot
+	}
+	return nil
+}
+
+// Start 在后台同步站点目录，站点已有同步任务时返回 ErrRunning
+func Start(site *models.Site) (*Progress, error) {
+	p, err := begin(site.ID)
+	if err != nil {
+		return nil, err
+	}
+	go run(context.Background(), site, p)
+	return Status(site.ID), nil
+}
+
+// Sync 同步站点目录并等待完成
+func Sync(ctx context.Context, site *models.Site) (*Progress, error) {
+	p, err := begin(site.ID)
+	if err != nil {
+		return nil, err
+	}
+	err = run(ctx, site, p)
+	return Status(site.ID), err
+}
+
+// StartScheduler 按固定间隔依次同步所有站点
+func StartScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			var sites []models.Site
+			if err := db.GetDB().Find(&sites).Error; err != nil {
+				log.Printf("定时同步目录失败: %v", err)
+				continue
+			}
+			for i := range sites {
+				if _, err := Sync(context.Background(), &sites[i]); err != nil && err != ErrRunning {
+					log.Printf("站点 %s 同步目录失败: %v", sites[i].Domain, err)
+				}
+			}
+		}
+	}()
+}
+
+// begin 登记新的同步任务
+func begin(siteID uint) (*Progress, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if p, ok := progress[siteID]; ok && p.Running {
+		return nil, ErrRunning
+	}
+	p := &Progress{SiteID: siteID, Running: true, StartedAt: time.Now()}
+	progress[siteID] = p
+	return p, nil
+}
+
+// update 在锁内修改进度
+func update(p *Progress, fn func(p *Progress)) {
+	mu.Lock()
+	defer mu.Unlock()
+	fn(p)
+}
+
+// run 执行同步并记录结果
+func run(ctx context.Context, site *models.Site, p *Progress) error {
+	err := syncSite(ctx, site, p)
+	update(p, func(p *Progress) {
+		now := time.Now()
+		p.Running = false
+		p.Current = ""
+		p.FinishedAt = &now
+		if err != nil {
+			p.Error = err.Error()
+		}
+	})
+	return err
+}
+
+// syncSite 遍历站点存储并与 files 表对比
+// 先完整遍历再写库，任何目录读取失败都会中止同步，避免把未遍历到的文件误删
+func syncSite(ctx context.Context, site *models.Site, p *Progress) error {
+	driver, err := storage.ForSite(site)
+	if err != nil {
+		return err
+	}
+
+	var objects []storage.Object
+	if err := walk(ctx, driver, "/", 0, p, &objects); err != nil {
+		return err
+	}
+
+	// 包括已软删除的记录，文件重新出现时恢复原记录，保留下载次数和积分配置
+	var rows []models.File
+	if err := db.GetDB().Unscoped().Where("site_id = ?", site.ID).Order("id").Find(&rows).Error; err != nil {
+		return err
+	}
+	existing := make(map[string]*models.File, len(rows))
+	for i := range rows {
+		// 同一路径有多条记录时以最早的为准
+		if _, ok := existing[rows[i].Path]; !ok {
+			existing[rows[i].Path] = &rows[i]
+		}
+	}
+
+	seen := make(map[string]bool, len(objects))
+	var added []storage.Object
+	tx := db.GetDB().Begin()
+	for _, object := range objects {
+		seen[object.Path] = true
+		file, ok := existing[object.Path]
+		if !ok {
+			added = append(added, object)
+			continue
+		}
+		if !changed(file, object) {
+			continue
+		}
+		fields := fileFields(object)
+		if file.ContentType == "" {
+			fields["content_type"] = contentType(object.Name)
+		}
+		if err := tx.Unscoped().Model(file).Updates(fields).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		update(p, func(p *Progress) { p.Updated++ })
+	}
+
+	// 消失的文件与新出现的文件大小和修改时间都一致时视为重命名或移动，沿用原记录
+	var missing []*models.File
+	for _, file := range existing {
+		if !seen[file.Path] && !file.DeletedAt.Valid {
+			missing = append(missing, file)
+		}
+	}
+	renamed := matchRenames(missing, added)
+	renamedIDs := make(map[uint]bool, len(renamed))
+	for _, file := range renamed {
+		renamedIDs[file.ID] = true
+	}
+
+	for _, object := range added {
+		if file, ok := renamed[object.Path]; ok {
+			fields := fileFields(object)
+			fields["path"] = object.Path
+			if err := tx.Model(file).Updates(fields).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+			// 积分配置按路径匹配，跟随文件一起移动
+			if err := movePointConfig(tx, site.ID, file.ID, object.Path); err != nil {
+				tx.Rollback()
+				return err
+			}
+			update(p, func(p *Progress) { p.Renamed++ })
+			continue
+		}
+
+		file := models.File{
+			SiteID:      site.ID,
+			Path:        object.Path,
+			Name:        object.Name,
+			Size:        object.Size,
+			ContentType: contentType(object.Name),
+			UploadedAt:  time.Now(),
+		}
+		if !object.Modified.IsZero() {
+			modified := object.Modified
+			file.ModifiedAt = &modified
+			file.UploadedAt = modified
+		}
+		if err := tx.Create(&file).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		// 关联先于文件入库配置的积分
+		if err := tx.Model(&models.PointConfig{}).Where("site_id = ? AND path = ? AND file_id IS NULL", site.ID, file.Path).Update("file_id", file.ID).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		update(p, func(p *Progress) { p.Created++ })
+	}
+
+	for _, file := range missing {
+		if renamedIDs[file.ID] {
+			continue
+		}
+		if err := tx.Delete(file).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		update(p, func(p *Progress) { p.Deleted++ })
+	}
+
+	return tx.Commit().Error
+}
+
+// movePointConfig 将文件的积分配置移动到新路径
+// 新路径上已有积分配置时以其为准并关联到该文件，文件原来的配置删除；已软删除的配置直接清除，避免路径唯一索引冲突
+func movePointConfig(tx *gorm.DB, siteID, fileID uint, newPath string) error {
+	var target models.PointConfig
+	err := tx.Unscoped().Where("site_id = ? AND path = ?", siteID, newPath).First(&target).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	if err == nil {
+		if !target.DeletedAt.Valid {
+			if err := tx.Unscoped().Where("site_id = ? AND file_id = ? AND id <> ?", siteID, fileID, target.ID).Delete(&models.PointConfig{}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&target).Update("file_id", fileID).Error
+		}
+		if err := tx.Unscoped().Delete(&target).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(&models.PointConfig{}).Where("site_id = ? AND file_id = ?", siteID, fileID).Update("path", newPath).Error
+}
+
+// walk 递归遍历目录，收集所有文件
+func walk(ctx context.Context, driver storage.Driver, dir string, depth int, p *Progress, objects *[]storage.Object) error {
+	if depth > maxDepth {
+		log.Printf("目录层级超过 %d 层，跳过: %s", maxDepth, dir)
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	update(p, func(p *Progress) {
+		p.Current = dir
+		p.Dirs++
+	})
+
+	entries, err := driver.List(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("读取目录 %s 失败: %w", dir, err)
+	}
+	for _, entry := range entries {
+		// 以 . 开头的文件不对外展示，也不入库
+		if strings.HasPrefix(entry.Name, ".") {
+			continue
+		}
+		if entry.IsDir {
+			if err := walk(ctx, driver, entry.Path, depth+1, p, objects); err != nil {
+				return err
+			}
+			continue
+		}
+		*objects = append(*objects, entry)
+		update(p, func(p *Progress) { p.Files++ })
+	}
+	return nil
+}
+
+// matchRenames 为新出现的文件在消失的文件中寻找唯一匹配，返回新路径到原记录的映射
+func matchRenames(missing []*models.File, added []storage.Object) map[string]*models.File {
+	type key struct {
+		size     int64
+		modified int64
+	}
+	candidates := map[key][]*models.File{}
+	for _, file := range missing {
+		if file.ModifiedAt == nil {
+			continue
+		}
+		k := key{file.Size, file.ModifiedAt.Unix()}
+		candidates[k] = append(candidates[k], file)
+	}
+	arrivals := map[key][]storage.Object{}
+	for _, object := range added {
+		if object.Modified.IsZero() {
+			continue
+		}
+		k := key{object.Size, object.Modified.Unix()}
+		arrivals[k] = append(arrivals[k], object)
+	}
+
+	// 只有一一对应时才认定为重命名，存在歧义时按删除和新增处理
+	renamed := map[string]*models.File{}
+	for k, files := range candidates {
+		if len(files) == 1 && len(arrivals[k]) == 1 {
+			renamed[arrivals[k][0].Path] = files[0]
+		}
+	}
+	return renamed
+}
+
+// changed 判断存储中的文件信息与记录是否不同，已软删除的记录需要恢复
+func changed(file *models.File, object storage.Object) bool {
+	if file.DeletedAt.Valid || file.Size != object.Size || file.Name != object.Name {
+		return true
+	}
+	if object.Modified.IsZero() {
+		return false
+	}
+	// 部分数据库只保存到秒
+	return file.ModifiedAt == nil || file.ModifiedAt.Unix() != object.Modified.Unix()
+}
+
+// fileFields 同步时更新的字段，上传时记录的文件类型不覆盖
+func fileFields(object storage.Object) map[string]interface{} {
+	fields := map[string]interface{}{
+		"name":       object.Name,
+		"size":       object.Size,
+		"deleted_at": gorm.DeletedAt{},
+	}
+	if !object.Modified.IsZero() {
+		fields["modified_at"] = object.Modified
+	}
+	return fields
+}
+
+// contentType 根据扩展名推断文件类型
+func contentType(name string) string {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
@@ -33,31 +33,115 @@ type AppConfig struct {
 	DBConn        string `json:"db_conn"`
 	DefaultPoints int    `json:"default_points"` // 默认积分配置
 	JWTSecret     string `json:"jwt_secret"`
+	EncryptionKey string `json:"encryption_key,omitempty"` // 加密数据库中存储凭据的密钥，留空时使用 jwt_secret
 	Alist         struct {
 		Host     string `json:"host"`
 		Username string `json:"username"`
 		Password string `json:"password"`
 	} `json:"alist"`
+	Storage           StorageConfig            `json:"storage,omitempty"`             // 默认存储驱动配置，未配置时使用 alist，各站点使用其中以域名命名的子目录
+	SharedStorageRoot bool                     `json:"shared_storage_root,omitempty"` // 未单独配置存储的站点直接使用默认存储的根目录，多个站点会共用同一目录，用于兼容升级前的单站点部署
+	PurchaseValidDays int                      `json:"purchase_valid_days"`           // 购买后的有效天数，有效期内重复下载不再扣积分，0 表示永久有效
+	SiteStorages      map[string]StorageConfig `json:"site_storages,omitempty"`       // 按站点域名单独配置存储，站点使用其根目录，未配置的站点使用 storage
+	HiddenPaths       []string                 `json:"hidden_paths,omitempty"`        // 不对外展示的路径，格式与定价规则相同，如 /private 或 /**/*.nfo
+	SyncInterval      int                      `json:"sync_interval,omitempty"`       // 定时同步存储目录到文件表的间隔（分钟），0 表示只手动同步
+	DownloadLinkTTL   int                      `json:"download_link_ttl,omitempty"`   // 下载链接的有效期（秒），默认 3600，过期后需重新获取，已购买的文件不会重复扣费
+	Upload            struct {
+		MaxSize      int64    `json:"max_size,omitempty"`      // 单个文件的上传大小上限（字节），0 表示不限制
+		AllowedTypes []string `json:"allowed_types,omitempty"` // 允许上传的类型，如 image/*、application/pdf、.zip，为空表示不限制
+		TempDir      string   `json:"temp_dir,omitempty"`      // 分片上传未完成时数据的保存目录，默认为系统临时目录下的 qlist-uploads
+	} `json:"upload,omitempty"` // 上传限制的默认值，站点可单独设置
+	Download struct {
+		DownloadLimit                          // 普通用户的下载限制
+		SiteRate      int                      `json:"site_rate,omitempty"` // 每个站点所有下载的总速度上限（KB/s），0 表示不限制
+		Tiers         map[string]DownloadLimit `json:"tiers,omitempty"`     // 会员等级的下载限制，按等级名称配置，会员有效期内替代普通用户的限制
+	} `json:"download,omitempty"`
+	Quota             DownloadQuota `json:"quota,omitempty"` // 用户下载配额的默认值，站点可单独设置
+	SiteStorageLimits struct {
+		LocalBaseDir     string   `json:"local_base_dir,omitempty"`    // 本地存储的根目录必须位于此目录下，相对路径按此目录解析，留空表示不允许站点使用本地存储
+		AllowedEndpoints []string `json:"allowed_endpoints,omitempty"` // 允许使用的存储服务地址，填写主机名或主机名:端口，支持 *.example.com，留空表示不允许
+	} `json:"site_storage_limits,omitempty"` // 站点管理员通过接口配置存储时的限制，不影响配置文件中的存储
 	// 三方登录配置，均为非必填，未配置则屏蔽对应登录方式
 	GoogleOAuth struct {
 		ClientID     string `json:"client_id"`
 		ClientSecret string `json:"client_secret"`
 		RedirectURI  string `json:"redirect_uri"`
+		AuthURL      string `json:"auth_url,omitempty"`     // 授权地址，留空使用 Google 官方地址
+		TokenURL     string `json:"token_url,omitempty"`    // 换取令牌地址，可指向本地模拟服务
+		UserInfoURL  string `json:"userinfo_url,omitempty"` // 用户信息地址，可指向本地模拟服务
 	} `json:"google_oauth,omitempty"`
 	GitHubOAuth struct {
 		ClientID     string `json:"client_id"`
 		ClientSecret string `json:"client_secret"`
 		RedirectURI  string `json:"redirect_uri"`
+		BaseURL      string `json:"base_url,omitempty"` // 授权与换取令牌地址，留空使用 https://github.com
+		APIBase      string `json:"api_base,omitempty"` // API 地址，留空使用 https://api.github.com
 	} `json:"github_oauth,omitempty"`
 	WechatOAuth struct {
 		AppID       string `json:"appid"`
 		AppSecret   string `json:"app_secret"`
 		RedirectURI string `json:"redirect_uri"`
+		OpenHost    string `json:"open_host,omitempty"` // 扫码页地址，留空使用 https://open.weixin.qq.com
+		APIHost     string `json:"api_host,omitempty"`  // 接口地址，留空使用 https://api.weixin.qq.com
 	} `json:"wechat_oauth,omitempty"`
+	// 微信支付 v3 配置，用于积分充值，未配置则不提供微信支付
+	WechatPay struct {
+		AppID          string `json:"appid"`              // 发起支付的公众号或网站应用 appid，JSAPI 支付的 openid 须属于此 appid
+		MchID          string `json:"mchid"`              // 商户号
+		SerialNo       string `json:"serial_no"`          // 商户 API 证书序列号
+		PrivateKeyPath string `json:"private_key_path"`   // 商户 API 私钥文件 apiclient_key.pem 的路径
+		APIv3Key       string `json:"apiv3_key"`          // APIv3 密钥，用于解密回调通知
+		PublicKeyID    string `json:"public_key_id"`      // 微信支付公钥 ID，如 PUB_KEY_ID_0000000000000000000000000000
+		PublicKeyPath  string `json:"public_key_path"`    // 微信支付公钥文件的路径，用于验证应答和回调的签名
+		NotifyURL      string `json:"notify_url"`         // 支付结果回调地址，需为外网可访问的 https 地址，如 https://example.com/api/pay/wechat/notify
+		APIHost        string `json:"api_host,omitempty"` // 接口地址，留空使用 https://api.mch.weixin.qq.com
+		Simulate       bool   `json:"simulate,omitempty"` // 模拟模式：不请求微信支付，使用进程内生成的密钥签发回调，用于本地联调
+	} `json:"wechat_pay,omitempty"`
+}
+
+// DownloadLimit 单个用户的下载限制，0 表示不限制
+type DownloadLimit struct {
+	Rate        int `json:"rate,omitempty"`        // 所有连接合计的下载速度上限（KB/s）
+	Connections int `json:"connections,omitempty"` // 同时下载的连接数上限
+}
+
+// DownloadQuota 每个用户的下载配额，按自然日和自然月统计，0 表示不限制
+type DownloadQuota struct {
+	DailyDownloads   int   `json:"daily_downloads,omitempty"`   // 每天付费下载的次数
+	MonthlyDownloads int   `json:"monthly_downloads,omitempty"` // 每月付费下载的次数
+	DailyTraffic     int64 `json:"daily_traffic,omitempty"`     // 每天下载的流量（MB）
+	MonthlyTraffic   int64 `json:"monthly_traffic,omitempty"`   // 每月下载的流量（MB）
+}
+
+// StorageConfig 存储驱动配置，不同驱动使用其中不同的字段
+type StorageConfig struct {
+	Driver      string `json:"driver"`                 // 驱动名称 alist / local / s3 / webdav
+	Endpoint    string `json:"endpoint,omitempty"`     // 服务地址
+	Username    string `json:"username,omitempty"`     // 用户名
+	Password    string `json:"password,omitempty"`     // 密码
+	Root        string `json:"root,omitempty"`         // 本地存储的根目录，s3 为桶内的前缀
+	Bucket      string `json:"bucket,omitempty"`       // s3 桶名
+	Region      string `json:"region,omitempty"`       // s3 区域，R2 填 auto
+	AccessKey   string `json:"access_key,omitempty"`   // s3 访问密钥 ID
+	SecretKey   string `json:"secret_key,omitempty"`   // s3 访问密钥
+	LinkExpires int    `json:"link_expires,omitempty"` // 预签名下载链接的有效秒数，默认 3600
 }
 
 var Instance AppConfig
 
+// EffectiveStorage 返回生效的存储配置，兼容只配置了 alist 的旧配置文件
+func (c *AppConfig) EffectiveStorage() StorageConfig {
+	if c.Storage.Driver != "" {
+		return c.Storage
+	}
+	return StorageConfig{
+		Driver:   "alist",
+		Endpoint: c.Alist.Host,
+		Username: c.Alist.Username,
+		Password: c.Alist.Password,
+	}
+}
+
 func LoadConfig(path string) error {
 	file, err := os.Open(path)
 	if err != nil {
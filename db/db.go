@@ -23,8 +23,19 @@ func InitDB() error {
 		return fmt.Errorf("数据库连接失败: %w", err)
 	}
 
+	// 积分余额增加了非负约束，迁移前修正历史上被扣成负数的数据
+	if db.Migrator().HasTable(&models.User{}) {
+		if err := db.Model(&models.User{}).Where("points < 0").Update("points", 0).Error; err != nil {
+			return fmt.Errorf("修正负积分失败: %w", err)
+		}
+	}
+
+	if err := migratePointConfigPath(); err != nil {
+		return err
+	}
+
 	// 自动迁移数据库结构
-	return db.AutoMigrate(&models.Site{}, &models.User{}, &models.PointConfig{}, &models.PointLog{}, &models.File{})
+	return db.AutoMigrate(&models.Site{}, &models.User{}, &models.PointConfig{}, &models.PriceRule{}, &models.PointLog{}, &models.File{}, &models.Purchase{}, &models.SiteStorage{}, &models.UploadSession{}, &models.DownloadLog{}, &models.PointPackage{}, &models.Order{}, &models.PaymentException{})
 }
 
 // GetDB 返回数据库连接实例
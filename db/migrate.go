@@ -0,0 +1,46 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"qlist/models"
+)
+
+// migratePointConfigPath 将按 file_id 定价的旧积分配置迁移为按路径定价
+// 需在 AutoMigrate 之前执行：旧的 (site_id, file_id) 唯一索引不允许多个未入库文件的配置共存，
+// 新的 (site_id, path) 唯一索引要求历史数据先回填路径
+func migratePointConfigPath() error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.PointConfig{}) {
+		return nil
+	}
+
+	if migrator.HasIndex(&models.PointConfig{}, "idx_site_path") {
+		if err := migrator.DropIndex(&models.PointConfig{}, "idx_site_path"); err != nil {
+			return fmt.Errorf("删除旧积分配置索引失败: %w", err)
+		}
+	}
+	if !migrator.HasColumn(&models.PointConfig{}, "path") {
+		if err := migrator.AddColumn(&models.PointConfig{}, "Path"); err != nil {
+			return fmt.Errorf("添加积分配置路径字段失败: %w", err)
+		}
+	}
+
+	// 根据关联的文件回填路径，未关联文件的配置 file_id 置空
+	if err := db.Exec("UPDATE point_configs SET path = (SELECT files.path FROM files WHERE files.id = point_configs.file_id) WHERE (path IS NULL OR path = '') AND file_id IS NOT NULL AND file_id <> 0").Error; err != nil {
+		return fmt.Errorf("回填积分配置路径失败: %w", err)
+	}
+	if err := db.Exec("UPDATE point_configs SET file_id = NULL WHERE file_id = 0").Error; err != nil {
+		return fmt.Errorf("清理积分配置文件关联失败: %w", err)
+	}
+
+	// 找不到对应文件的配置无法定位路径，也从未生效过，直接清除
+	result := db.Unscoped().Where("path IS NULL OR path = ''").Delete(&models.PointConfig{})
+	if result.Error != nil {
+		return fmt.Errorf("清理无效积分配置失败: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("已清除 %d 条找不到对应文件的积分配置", result.RowsAffected)
+	}
+	return nil
+}
@@ -5,15 +5,20 @@ import (
 	"net/http"
 	"os"
 	"qlist/api"
+	"qlist/billing"
+	"qlist/catalog"
 	"qlist/cmd"
 	"qlist/config"
 	"qlist/db"
 	"qlist/docs"
 	"qlist/handlers"
 	"qlist/middleware"
+	"qlist/pkg/wechatpay"
 	"qlist/public"
 	"qlist/storage"
+	"qlist/upload"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -51,7 +56,28 @@ func main() {
 	}
 
 	// 初始化存储服务
-	storage.Init()
+	if err := storage.Init(); err != nil {
+		log.Fatalf("无法初始化存储服务: %v", err)
+	}
+
+	// 模拟支付只用于本地联调，不能与真实商户同时启用
+	if err := wechatpay.CheckConfig(); err != nil {
+		log.Fatalf("微信支付配置无效: %v", err)
+	}
+	if wechatpay.Simulated() && !middleware.IsDev() {
+		log.Fatalf("微信支付模拟模式只能在开发环境（ENV=development）下使用")
+	}
+
+	// 定时同步存储目录
+	if config.Instance.SyncInterval > 0 {
+		catalog.StartScheduler(time.Duration(config.Instance.SyncInterval) * time.Minute)
+	}
+
+	// 定时清理过期的分片上传
+	upload.StartCleanup(time.Hour)
+
+	// 定时关闭超时未支付的充值订单
+	billing.StartExpirer(time.Minute)
 
 	// 初始化 Gin 引擎
 	router := gin.Default()
@@ -88,29 +114,107 @@ func main() {
 		(&handlers.StaticHandler{}).ServeHTTP(c.Writer, c.Request)
 	})
 
+	// 签名下载链接，令牌本身即为凭据
+	router.GET("/d/:token", api.ProxyDownload)
+	router.HEAD("/d/:token", api.ProxyDownload)
+
 	// API 路由
+	userAuth := middleware.UserAuthMiddleware()
+	adminAuth := middleware.AdminAuthMiddleware()
 	apiGroup := router.Group("/api")
 	{
+		// 登录注册
+		apiGroup.POST("/register/local", api.RegisterLocal)
+		apiGroup.POST("/login/local", api.LoginLocal)
+		apiGroup.POST("/logout", api.Logout)
+		apiGroup.GET("/login/options", api.GetLoginOptions)
+
+		// 三方登录
+		oauthGroup := apiGroup.Group("/oauth", middleware.OptionalUserAuthMiddleware())
+		{
+			oauthGroup.GET("/google/start", api.GoogleLoginStart)
+			oauthGroup.GET("/google/callback", api.GoogleLoginCallback)
+			oauthGroup.GET("/github/start", api.GitHubLoginStart)
+			oauthGroup.GET("/github/callback", api.GitHubLoginCallback)
+			oauthGroup.GET("/wechat/start", api.WechatLoginStart)
+			oauthGroup.GET("/wechat/callback", api.WechatLoginCallback)
+			oauthGroup.GET("/pending", api.GetPendingOAuthLink)
+			oauthGroup.POST("/pending/confirm", api.ConfirmOAuthLink)
+			oauthGroup.POST("/pending/skip", api.SkipOAuthLink)
+		}
+
 		// 积分相关
 		pointsGroup := apiGroup.Group("/points")
 		{
-			pointsGroup.GET("", api.GetPointsList)
-			pointsGroup.POST("/configure", api.ConfigurePoints)
-			pointsGroup.GET("/log", api.GetPointsLog)
+			pointsGroup.GET("", adminAuth, api.GetPointsList)
+			pointsGroup.POST("/configure", adminAuth, api.ConfigurePoints)
+			pointsGroup.GET("/rules", adminAuth, api.GetPriceRules)
+			pointsGroup.POST("/rules", adminAuth, api.SavePriceRule)
+			pointsGroup.DELETE("/rules/:id", adminAuth, api.DeletePriceRule)
+			pointsGroup.GET("/log", userAuth, api.GetPointsLog)
 		}
 
 		// 用户相关
 		usersGroup := apiGroup.Group("/users")
 		{
-			usersGroup.GET("", api.GetUsersList)
-			usersGroup.POST("/grant", api.AdminGrantPoints)
-			usersGroup.GET("/points", api.GetUserPoints)
+			usersGroup.GET("", adminAuth, api.GetUsersList)
+			usersGroup.POST("/grant", adminAuth, api.AdminGrantPoints)
+			usersGroup.POST("/uploader", adminAuth, api.AdminSetUploader)
+			usersGroup.POST("/tier", adminAuth, api.AdminSetTier)
+			usersGroup.GET("/points", userAuth, api.GetUserPoints)
+			usersGroup.GET("/quota", userAuth, api.GetUserQuota)
+		}
+
+		// 积分充值
+		apiGroup.GET("/packages", api.GetPointPackages)
+		apiGroup.GET("/packages/all", adminAuth, api.GetAllPointPackages)
+		apiGroup.POST("/packages", adminAuth, api.SavePointPackage)
+		apiGroup.DELETE("/packages/:id", adminAuth, api.DeletePointPackage)
+		ordersGroup := apiGroup.Group("/orders")
+		{
+			ordersGroup.POST("", userAuth, api.CreateOrder)
+			ordersGroup.GET("", userAuth, api.GetOrders)
+			ordersGroup.GET("/:order_no", userAuth, api.GetOrder)
+			ordersGroup.POST("/:order_no/fulfill", adminAuth, api.AdminFulfillOrder)
+			ordersGroup.POST("/:order_no/refund", adminAuth, api.AdminRefundOrder)
+			ordersGroup.POST("/:order_no/wechat", userAuth, api.WechatPayOrder)
+			ordersGroup.POST("/:order_no/wechat/simulate", userAuth, api.SimulateWechatPay)
+		}
+		apiGroup.POST("/pay/wechat/notify", api.WechatPayNotify)
+
+		// 站点下载配额
+		apiGroup.GET("/quota", adminAuth, api.GetSiteQuota)
+		apiGroup.POST("/quota", adminAuth, api.SaveSiteQuota)
+
+		// 站点存储配置
+		storageGroup := apiGroup.Group("/storage", adminAuth)
+		{
+			storageGroup.GET("", api.GetSiteStorage)
+			storageGroup.POST("", api.SaveSiteStorage)
+			storageGroup.DELETE("", api.DeleteSiteStorage)
 		}
 
 		// 文件相关
-		apiGroup.GET("/download", api.DownloadFile)
+		downloadGroup := apiGroup.Group("/download", userAuth)
+		{
+			downloadGroup.GET("", api.DownloadFile)
+		}
+		apiGroup.GET("/fs/list", middleware.OptionalUserAuthMiddleware(), api.ListDirectory)
 		apiGroup.GET("/fileinfo", api.GetFileInfo)
 		apiGroup.GET("/files/recent", api.GetRecentFiles)
+		apiGroup.POST("/files/upload", middleware.UploaderAuthMiddleware(), api.UploadFile)
+		apiGroup.GET("/files/upload/limits", adminAuth, api.GetUploadLimits)
+		uploadsGroup := apiGroup.Group("/files/uploads", middleware.UploaderAuthMiddleware())
+		{
+			uploadsGroup.POST("", api.CreateUploadSession)
+			uploadsGroup.GET("/:id", api.GetUploadSession)
+			uploadsGroup.PUT("/:id", api.UploadChunk)
+			uploadsGroup.POST("/:id/commit", api.CommitUpload)
+			uploadsGroup.DELETE("/:id", api.CancelUpload)
+		}
+		apiGroup.POST("/files/upload/limits", adminAuth, api.SaveUploadLimits)
+		apiGroup.GET("/files/sync", adminAuth, api.GetCatalogSyncStatus)
+		apiGroup.POST("/files/sync", adminAuth, api.StartCatalogSync)
 	}
 
 	// 启动服务器
@@ -1,9 +1,13 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"qlist/config"
+	"qlist/models"
 	"strings"
+
+	"github.com/gin-gonic/gin"
 )
 
 // AuthMiddleware 认证中间件结构体
@@ -68,3 +72,68 @@ func (m *AuthMiddleware) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 		m.BasicAuth(next)(w, r)
 	}
 }
+
+// AdminAuthMiddleware 管理员认证中间件，接受有效的 API Key 或当前站点的管理员登录态
+func AdminAuthMiddleware() gin.HandlerFunc {
+	return roleAuthMiddleware("需要管理员权限", func(user *models.User) bool {
+		return user.IsAdmin
+	})
+}
+
+// UploaderAuthMiddleware 上传权限认证中间件，接受有效的 API Key、管理员或上传者
+func UploaderAuthMiddleware() gin.HandlerFunc {
+	return roleAuthMiddleware("需要上传权限", func(user *models.User) bool {
+		return user.IsAdmin || user.IsUploader
+	})
+}
+
+// roleAuthMiddleware 校验 API Key 或当前站点用户的角色
+func roleAuthMiddleware(deniedMessage string, allowed func(user *models.User) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 优先校验 API Key，供脚本和后台调用
+		apiKey := c.GetHeader("X-API-Key")
+		if apiKey == "" {
+			apiKey = c.Query("api_key")
+		}
+		if apiKey != "" {
+			if config.Instance.APIKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(config.Instance.APIKey)) != 1 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的API Key", "code": http.StatusUnauthorized})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		site, exists := GetSiteFromContext(c)
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "无法获取站点信息", "code": http.StatusInternalServerError})
+			c.Abort()
+			return
+		}
+
+		user, exists := GetUserFromContext(c)
+		if !exists {
+			var err error
+			user, err = authenticateUser(c, site)
+			if err != nil {
+				if err == errUserLookup {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": http.StatusInternalServerError})
+					c.Abort()
+					return
+				}
+				abortUnauthorized(c, err.Error())
+				return
+			}
+		}
+
+		if !allowed(user) || user.SiteID != site.ID {
+			c.JSON(http.StatusForbidden, gin.H{"error": deniedMessage, "code": http.StatusForbidden})
+			c.Abort()
+			return
+		}
+
+		c.Set(UserContextKey, user)
+		c.Next()
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"errors"
+	"qlist/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStorageFromContext 根据上下文中的站点返回其存储驱动，站点之间的文件互相隔离
+func GetStorageFromContext(c *gin.Context) (storage.Driver, error) {
+	site, exists := GetSiteFromContext(c)
+	if !exists {
+		return nil, errors.New("无法获取站点信息")
+	}
+	return storage.ForSite(site)
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"qlist/db"
+	"qlist/models"
+	"qlist/pkg/auth"
+	"qlist/pkg/oauth"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UserContextKey 定义用于在上下文中存储当前登录用户的键
+const UserContextKey = "user"
+
+var (
+	errNotLoggedIn       = errors.New("用户未登录")
+	errTokenInvalid      = errors.New("登录已失效，请重新登录")
+	errTokenSiteMismatch = errors.New("登录令牌不属于当前站点")
+	errUserNotFound      = errors.New("用户不存在")
+	errUserLookup        = errors.New("查询用户失败")
+)
+
+// UserAuthMiddleware 用户认证中间件，校验 Bearer JWT 或会话 Cookie 并加载当前站点的用户
+func UserAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		site, exists := GetSiteFromContext(c)
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "无法获取站点信息", "code": http.StatusInternalServerError})
+			c.Abort()
+			return
+		}
+
+		user, err := authenticateUser(c, site)
+		if err != nil {
+			if err == errUserLookup {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": http.StatusInternalServerError})
+				c.Abort()
+				return
+			}
+			abortUnauthorized(c, err.Error())
+			return
+		}
+
+		c.Set(UserContextKey, user)
+		c.Next()
+	}
+}
+
+// OptionalUserAuthMiddleware 可选的用户认证中间件，已登录时加载用户，未登录或令牌无效时按游客继续处理
+func OptionalUserAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if site, exists := GetSiteFromContext(c); exists {
+			if user, err := authenticateUser(c, site); err == nil {
+				c.Set(UserContextKey, user)
+			}
+		}
+		c.Next()
+	}
+}
+
+// GetUserFromContext 从 Gin 上下文中获取当前登录用户
+func GetUserFromContext(c *gin.Context) (*models.User, bool) {
+	user, exists := c.Get(UserContextKey)
+	if !exists {
+		return nil, false
+	}
+	return user.(*models.User), true
+}
+
+// authenticateUser 校验请求携带的令牌并加载对应的用户，令牌只能在签发它的站点使用
+func authenticateUser(c *gin.Context, site *models.Site) (*models.User, error) {
+	tokenString := extractToken(c)
+	if tokenString == "" {
+		return nil, errNotLoggedIn
+	}
+
+	claims, err := auth.ParseToken(tokenString)
+	if err != nil {
+		return nil, errTokenInvalid
+	}
+	if claims.SiteID != site.ID {
+		return nil, errTokenSiteMismatch
+	}
+
+	var user models.User
+	if err := db.GetDB().Where("id = ? AND site_id = ?", claims.UserID, site.ID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errUserNotFound
+		}
+		return nil, errUserLookup
+	}
+	return &user, nil
+}
+
+// extractToken 依次从 Authorization 头和会话 Cookie 中读取令牌
+func extractToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); header != "" {
+		if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if token, err := c.Cookie(auth.TokenCookieName); err == nil {
+		return token
+	}
+	return ""
+}
+
+// abortUnauthorized 返回 401，并附带可用的登录方式供前端展示
+func abortUnauthorized(c *gin.Context, message string) {
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error":         message,
+		"code":          http.StatusUnauthorized,
+		"login_options": LoginOptions(),
+	})
+	c.Abort()
+}
+
+// LoginOptions 返回当前可用的登录方式
+func LoginOptions() []gin.H {
+	options := []gin.H{
+		{"name": "邮箱登录", "url": "/dist/login.html"},
+		{"name": "邮箱注册", "url": "/dist/register.html"},
+	}
+	// 三方登录未配置时不展示
+	if oauth.GoogleEnabled() {
+		options = append(options, gin.H{"name": "Google", "url": "/api/oauth/google/start"})
+	}
+	if oauth.GitHubEnabled() {
+		options = append(options, gin.H{"name": "GitHub", "url": "/api/oauth/github/start"})
+	}
+	if oauth.WechatEnabled() {
+		options = append(options, gin.H{"name": "微信", "url": "/api/oauth/wechat/start"})
+	}
+	return options
+}
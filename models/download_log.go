@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// DownloadLog 下载记录，每次通过下载链接传输文件后写入，用于统计用户的下载流量
+type DownloadLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SiteID    uint      `gorm:"column:site_id;index:idx_download_log_user_time;not null" json:"siteId"`
+	UserID    uint      `gorm:"column:user_id;index:idx_download_log_user_time;not null" json:"userId"`
+	FileID    uint      `gorm:"column:file_id;index" json:"fileId"`
+	Path      string    `gorm:"column:path;size:1024" json:"path"`
+	Size      int64     `gorm:"column:size" json:"size"` // 实际传输的字节数，断点续传时为本次请求的范围
+	CreatedAt time.Time `gorm:"column:created_at;index:idx_download_log_user_time" json:"createdAt"`
+}
+
+// TableName 指定表名
+func (DownloadLog) TableName() string {
+	return "download_logs"
+}
@@ -16,8 +16,9 @@ type File struct {
 	ContentType string    `gorm:"column:content_type;type:varchar(100)" json:"contentType"`     // 文件类型
 	Downloads   int       `gorm:"column:downloads;default:0" json:"downloads"`                 // 下载次数
 	UploadedAt  time.Time `gorm:"column:uploaded_at;default:CURRENT_TIMESTAMP" json:"uploadedAt"` // 上传时间
+	ModifiedAt  *time.Time `gorm:"column:modified_at" json:"modifiedAt,omitempty"`               // 存储中的修改时间，由目录同步更新
 	Site        Site      `gorm:"foreignKey:SiteID"`
-	PointConfig PointConfig `json:"pointConfig,omitempty"` // 关联的积分配置
+	PointConfig PointConfig `gorm:"constraint:OnDelete:SET NULL" json:"pointConfig,omitempty"` // 关联的积分配置
 }
 
 // TableName 指定表名
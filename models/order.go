@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 订单状态：created 待支付，paid 已支付待发放积分，fulfilled 积分已发放，refunded 已退款，expired 超时未支付
+const (
+	OrderCreated   = "created"
+	OrderPaid      = "paid"
+	OrderFulfilled = "fulfilled"
+	OrderRefunded  = "refunded"
+	OrderExpired   = "expired"
+)
+
+// PointPackage 积分充值套餐
+type PointPackage struct {
+	gorm.Model
+	SiteID      uint   `gorm:"column:site_id;index;not null" json:"siteId"`
+	Name        string `gorm:"column:name;size:64;not null" json:"name"`
+	Description string `gorm:"column:description;size:255" json:"description"`
+	PriceCents  int64  `gorm:"column:price_cents;not null" json:"priceCents"` // 价格（分）
+	Points      int    `gorm:"column:points;not null" json:"points"`          // 到账积分
+	Enabled     bool   `gorm:"column:enabled" json:"enabled"`                 // 停用的套餐不再展示，也不能下单
+	Sort        int    `gorm:"column:sort;default:0" json:"sort"`             // 展示顺序，从小到大
+	Site        Site   `gorm:"foreignKey:SiteID" json:"-"`
+}
+
+// TableName 指定表名
+func (PointPackage) TableName() string {
+	return "point_packages"
+}
+
+// Order 积分充值订单，下单时记录套餐的价格和积分，套餐之后修改不影响已有订单
+type Order struct {
+	gorm.Model
+	OrderNo       string     `gorm:"column:order_no;size:32;uniqueIndex;not null" json:"orderNo"`
+	SiteID        uint       `gorm:"column:site_id;index;not null" json:"siteId"`
+	UserID        uint       `gorm:"column:user_id;index;not null" json:"userId"`
+	PackageID     uint       `gorm:"column:package_id;index" json:"packageId"`
+	Subject       string     `gorm:"column:subject;size:128" json:"subject"`          // 订单标题，取自套餐名称
+	AmountCents   int64      `gorm:"column:amount_cents;not null" json:"amountCents"` // 应付金额（分）
+	Points        int        `gorm:"column:points;not null" json:"points"`
+	Status        string     `gorm:"column:status;size:16;index;not null" json:"status"`
+	PayMethod     string     `gorm:"column:pay_method;size:32" json:"payMethod,omitempty"`               // 支付方式，如 wechat、manual
+	TransactionID string     `gorm:"column:transaction_id;size:64;index" json:"transactionId,omitempty"` // 支付渠道的交易号
+	PointLogID    uint       `gorm:"column:point_log_id" json:"pointLogId,omitempty"`                    // 发放积分的日志
+	ExpiresAt     time.Time  `gorm:"column:expires_at;index" json:"expiresAt"`                           // 超过此时间未支付的订单过期
+	PaidAt        *time.Time `gorm:"column:paid_at" json:"paidAt,omitempty"`
+	FulfilledAt   *time.Time `gorm:"column:fulfilled_at" json:"fulfilledAt,omitempty"`
+	RefundedAt    *time.Time `gorm:"column:refunded_at" json:"refundedAt,omitempty"`
+	Site          Site       `gorm:"foreignKey:SiteID" json:"-"`
+}
+
+// TableName 指定表名
+func (Order) TableName() string {
+	return "orders"
+}
+
+// PaymentException 无法入账的支付通知，如订单不存在、金额不一致或订单已退款后又收到支付，需人工核对处理
+type PaymentException struct {
+	gorm.Model
+	OrderNo       string `gorm:"column:order_no;size:32;index" json:"orderNo"`
+	SiteID        uint   `gorm:"column:site_id;index" json:"siteId"` // 订单不存在时为 0
+	PayMethod     string `gorm:"column:pay_method;size:32" json:"payMethod"`
+	TransactionID string `gorm:"column:transaction_id;size:64;uniqueIndex" json:"transactionId"`
+	AmountCents   int64  `gorm:"column:amount_cents" json:"amountCents"` // 实际支付的金额（分）
+	Reason        string `gorm:"column:reason;size:255" json:"reason"`
+}
+
+// TableName 指定表名
+func (PaymentException) TableName() string {
+	return "payment_exceptions"
+}
@@ -8,35 +8,63 @@ import (
 
 // User 用户模型，支持多渠道（provider）和本地密码
 type User struct {
-	ID        uint       `gorm:"primaryKey" json:"id"`
-	SiteID    uint       `gorm:"index:idx_user_site_provider,unique;not null,default:0" json:"siteId"`
-	Username  string     `gorm:"index:idx_user_site_provider,unique;size:128" json:"username"` // 用户名或邮箱
-	Provider  string     `gorm:"index:idx_user_site_provider,unique;size:32" json:"provider"`  // 用户来源渠道 local/google/github/wechat
-	Password  string     `gorm:"size:255" json:"password,omitempty"`                           // 本地用户密码，三方登录为空
-	Points    int        `json:"points"`
-	IsAdmin   bool       `gorm:"default:false" json:"isAdmin"`
-	Logs      []PointLog `gorm:"foreignKey:UserID" json:"logs,omitempty"`
-	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
-	Site      Site       `gorm:"foreignKey:SiteID"`
-}
-
-// PointConfig 积分配置
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	SiteID        uint       `gorm:"index:idx_user_site_provider,unique;not null,default:0" json:"siteId"`
+	Username      string     `gorm:"index:idx_user_site_provider,unique;size:128" json:"username"` // 用户名或邮箱
+	Provider      string     `gorm:"index:idx_user_site_provider,unique;size:32" json:"provider"`  // 用户来源渠道 local/google/github/wechat
+	Password      string     `gorm:"size:255" json:"password,omitempty"`                           // 本地用户密码，三方登录为空
+	Email         string     `gorm:"size:255;index" json:"email,omitempty"`                        // 邮箱，三方登录时由渠道提供
+	Nickname      string     `gorm:"size:128" json:"nickname,omitempty"`                           // 昵称
+	Avatar        string     `gorm:"size:512" json:"avatar,omitempty"`                             // 头像地址
+	LinkedID      uint       `gorm:"index;default:0" json:"linkedId,omitempty"`                    // 关联的本地账号ID，非0时以该账号登录
+	WechatOpenID  string     `gorm:"column:wechat_open_id;size:64;index" json:"-"`                 // 微信登录的 openid
+	WechatUnionID string     `gorm:"column:wechat_union_id;size:64;index" json:"-"`                // 微信登录的 unionid，应用未绑定开放平台时为空
+	Points        int        `gorm:"check:chk_users_points,points >= 0" json:"points"`             // 积分余额，数据库层约束不能为负
+	IsAdmin       bool       `gorm:"default:false" json:"isAdmin"`
+	IsUploader    bool       `gorm:"default:false" json:"isUploader"` // 上传者可以上传文件，无其他管理权限
+	Tier          string     `gorm:"size:32" json:"tier,omitempty"`   // 会员等级，对应配置中 download.tiers 的名称，为空表示普通用户
+	TierExpiresAt *time.Time `json:"tierExpiresAt,omitempty"`         // 会员到期时间，为空表示长期有效
+	Logs          []PointLog `gorm:"foreignKey:UserID" json:"logs,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	Site          Site       `gorm:"foreignKey:SiteID"`
+}
+
+// ActiveTier 返回当前有效的会员等级，未开通或已过期时返回空字符串
+func (u *User) ActiveTier() string {
+	if u.Tier == "" || (u.TierExpiresAt != nil && !u.TierExpiresAt.After(time.Now())) {
+		return ""
+	}
+	return u.Tier
+}
+
+// PointConfig 积分配置，按路径定价，文件入库后通过 FileID 关联到 files 表
 type PointConfig struct {
 	gorm.Model
-	SiteID      uint   `gorm:"uniqueIndex:idx_site_path;not null,default:0" json:"siteId"`
-	FileID      uint   `gorm:"uniqueIndex:idx_site_path;not null,default:0" json:"fileId"`
+	SiteID      uint   `gorm:"uniqueIndex:idx_point_config_site_path;not null,default:0" json:"siteId"`
+	FileID      *uint  `gorm:"index" json:"fileId"`                                                            // 关联的文件，文件尚未入库时为空
+	Path        string `gorm:"column:path;type:varchar(255);uniqueIndex:idx_point_config_site_path" json:"path"` // 文件路径
 	Points      int    `gorm:"column:points" json:"points"`                                                    // 积分值
 	Description string `gorm:"column:description;type:varchar(255)" json:"description"`                        // 积分描述
 	Site        Site   `gorm:"foreignKey:SiteID"`
 }
 
+// PriceRule 目录或通配符定价规则，对没有单独配置积分的文件按特异性生效
+type PriceRule struct {
+	gorm.Model
+	SiteID      uint   `gorm:"uniqueIndex:idx_price_rule_site_pattern;not null" json:"siteId"`
+	Pattern     string `gorm:"column:pattern;type:varchar(255);uniqueIndex:idx_price_rule_site_pattern" json:"pattern"` // 目录前缀如 /courses，或通配符如 /courses/**/*.mp4
+	Points      int    `gorm:"column:points" json:"points"`                                                             // 积分值
+	Description string `gorm:"column:description;type:varchar(255)" json:"description"`                                 // 规则描述
+	Site        Site   `gorm:"foreignKey:SiteID" json:"-"`
+}
+
 // PointLog 积分变更日志
 type PointLog struct {
 	gorm.Model
 	UserID    uint      `gorm:"column:user_id;index" json:"userId"` // 用户ID
 	SiteID    uint      `gorm:"column:site_id;index;not null,default:0" json:"siteId"`
 	Points    int       `gorm:"column:points" json:"points"`                                // 变更积分值（正数为增加，负数为减少）
-	Action    string    `gorm:"column:action;type:varchar(50)" json:"action"`               // 变更类型：file_access（文件访问）, admin_grant（管理员授予）
+	Action    string    `gorm:"column:action;type:varchar(50)" json:"action"`               // 变更类型：file_access（文件访问）, admin_grant（管理员授予）, recharge（积分充值）
 	Details   string    `gorm:"column:details;type:varchar(255)" json:"details"`            // 变更描述
 	CreatedAt time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"createdAt"` // 变更时间
 	Site      Site      `gorm:"foreignKey:SiteID"`
@@ -50,6 +78,10 @@ func (PointConfig) TableName() string {
 	return "point_configs"
 }
 
+func (PriceRule) TableName() string {
+	return "price_rules"
+}
+
 func (PointLog) TableName() string {
 	return "point_logs"
 }
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Purchase 文件购买记录，有效期内重复下载同一文件不再扣除积分
+type Purchase struct {
+	gorm.Model
+	UserID     uint       `gorm:"column:user_id;uniqueIndex:idx_purchase_user_file;not null" json:"userId"`
+	SiteID     uint       `gorm:"column:site_id;uniqueIndex:idx_purchase_user_file;not null" json:"siteId"`
+	FileID     uint       `gorm:"column:file_id;uniqueIndex:idx_purchase_user_file;not null" json:"fileId"`
+	Points     int        `gorm:"column:points" json:"points"`              // 购买时支付的积分
+	PointLogID uint       `gorm:"column:point_log_id" json:"pointLogId"`    // 对应的积分扣除日志
+	ExpiresAt  *time.Time `gorm:"column:expires_at;index" json:"expiresAt"` // 过期时间，为空表示永久有效
+	Site       Site       `gorm:"foreignKey:SiteID" json:"-"`
+}
+
+// TableName 指定表名
+func (Purchase) TableName() string {
+	return "purchases"
+}
+
+// Valid 判断购买记录当前是否仍然有效
+func (p *Purchase) Valid(now time.Time) bool {
+	return p.ExpiresAt == nil || p.ExpiresAt.After(now)
+}
@@ -6,14 +6,25 @@ import (
 
 // Site 站点模型，用于区分不同站点的数据
 type Site struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Name      string    `gorm:"size:255;not null" json:"name"`
-	Domain    string    `gorm:"size:255;uniqueIndex" json:"domain"`
-	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+	ID                 uint          `gorm:"primaryKey" json:"id"`
+	Name               string        `gorm:"size:255;not null" json:"name"`
+	Domain             string        `gorm:"size:255;uniqueIndex" json:"domain"`
+	MaxUploadSize      int64         `gorm:"default:0" json:"maxUploadSize"`              // 单个文件的上传大小上限（字节），0 表示使用配置文件中的默认值
+	AllowedUploadTypes string        `gorm:"size:1024" json:"allowedUploadTypes"`         // 允许上传的类型，逗号分隔，如 image/*,application/pdf,.zip，为空时使用默认值
+	Quota              DownloadQuota `gorm:"embedded;embeddedPrefix:quota_" json:"quota"` // 用户下载配额，0 表示使用配置文件中的默认值
+	CreatedAt          time.Time     `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt          time.Time     `gorm:"autoUpdateTime" json:"updatedAt"`
 }
 
 // TableName 指定表名
 func (Site) TableName() string {
 	return "sites"
-}
\ No newline at end of file
+}
+
+// DownloadQuota 每个用户的下载配额，按自然日和自然月统计
+type DownloadQuota struct {
+	DailyDownloads   int   `gorm:"default:0" json:"dailyDownloads"`   // 每天付费下载的次数
+	MonthlyDownloads int   `gorm:"default:0" json:"monthlyDownloads"` // 每月付费下载的次数
+	DailyTraffic     int64 `gorm:"default:0" json:"dailyTraffic"`     // 每天下载的流量（MB）
+	MonthlyTraffic   int64 `gorm:"default:0" json:"monthlyTraffic"`   // 每月下载的流量（MB）
+}
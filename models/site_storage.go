@@ -0,0 +1,28 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// SiteStorage 站点的存储配置，每个站点最多一条，未配置时使用配置文件中的存储
+// Password 和 SecretKey 加密后保存，不会通过接口返回
+type SiteStorage struct {
+	gorm.Model
+	SiteID      uint   `gorm:"column:site_id;uniqueIndex;not null" json:"siteId"`
+	Driver      string `gorm:"column:driver;size:32;not null" json:"driver"`
+	Endpoint    string `gorm:"column:endpoint;size:512" json:"endpoint"`
+	Username    string `gorm:"column:username;size:255" json:"username"`
+	Password    string `gorm:"column:password;type:text" json:"-"`
+	Root        string `gorm:"column:root;size:512" json:"root"` // 站点可访问的根路径，站点之间互相隔离
+	Bucket      string `gorm:"column:bucket;size:255" json:"bucket"`
+	Region      string `gorm:"column:region;size:64" json:"region"`
+	AccessKey   string `gorm:"column:access_key;size:255" json:"accessKey"`
+	SecretKey   string `gorm:"column:secret_key;type:text" json:"-"`
+	LinkExpires int    `gorm:"column:link_expires" json:"linkExpires"`
+	Site        Site   `gorm:"foreignKey:SiteID" json:"-"`
+}
+
+// TableName 指定表名
+func (SiteStorage) TableName() string {
+	return "site_storages"
+}
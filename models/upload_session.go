@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// UploadSession 分片上传会话，已接收的数据保存在临时目录，提交后写入存储并删除会话
+type UploadSession struct {
+	ID          string    `gorm:"column:id;primaryKey;size:32" json:"id"`
+	SiteID      uint      `gorm:"column:site_id;index;not null" json:"siteId"`
+	UserID      uint      `gorm:"column:user_id;index;default:0" json:"userId"` // 创建会话的用户，使用 API Key 创建时为 0
+	Path        string    `gorm:"column:path;size:1024;not null" json:"path"`   // 提交后文件在存储中的路径
+	Name        string    `gorm:"column:name;size:255;not null" json:"name"`
+	Size        int64     `gorm:"column:size;not null" json:"size"`       // 文件总大小
+	Offset      int64     `gorm:"column:received;not null" json:"offset"` // 已接收的字节数，续传时从此处开始
+	ContentType string    `gorm:"column:content_type;size:255" json:"contentType"`
+	Points      *int      `gorm:"column:points" json:"points,omitempty"` // 提交时设置的积分，为空表示不单独定价
+	Description string    `gorm:"column:description;size:255" json:"description,omitempty"`
+	ExpiresAt   time.Time `gorm:"column:expires_at;index" json:"expiresAt"` // 超过此时间未完成的会话会被清理
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// TableName 指定表名
+func (UploadSession) TableName() string {
+	return "upload_sessions"
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"errors"
+	"qlist/config"
+	"qlist/models"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenCookieName 登录成功后写入浏览器的会话 Cookie 名称
+const TokenCookieName = "qlist_token"
+
+// TokenTTL 登录令牌有效期
+const TokenTTL = 7 * 24 * time.Hour
+
+// Claims JWT 载荷，令牌只在签发它的站点内有效
+type Claims struct {
+	UserID   uint   `json:"uid"`
+	SiteID   uint   `json:"sid"`
+	Provider string `json:"provider"`
+	jwt.RegisteredClaims
+}
+
+// GenerateToken 为用户签发 JWT
+func GenerateToken(user *models.User) (string, error) {
+	if config.Instance.JWTSecret == "" {
+		return "", errors.New("未配置 jwt_secret")
+	}
+
+	now := time.Now()
+	claims := Claims{
+		UserID:   user.ID,
+		SiteID:   user.SiteID,
+		Provider: user.Provider,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(TokenTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.Instance.JWTSecret))
+}
+
+// ParseToken 校验并解析 JWT
+func ParseToken(tokenString string) (*Claims, error) {
+	if config.Instance.JWTSecret == "" {
+		return nil, errors.New("未配置 jwt_secret")
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.Instance.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,108 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"qlist/config"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	githubBaseURL = "https://github.com"
+	githubAPIBase = "https://api.github.com"
+)
+
+// GitHubEnabled 判断是否配置了 GitHub 登录
+func GitHubEnabled() bool {
+	return config.Instance.GitHubOAuth.ClientID != "" && config.Instance.GitHubOAuth.ClientSecret != ""
+}
+
+func githubBase() string {
+	if base := config.Instance.GitHubOAuth.BaseURL; base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	return githubBaseURL
+}
+
+func githubAPI() string {
+	if base := config.Instance.GitHubOAuth.APIBase; base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	return githubAPIBase
+}
+
+// GitHubAuthCodeURL 生成跳转到 GitHub 授权页的地址
+func GitHubAuthCodeURL(state, redirectURI string) string {
+	query := url.Values{}
+	query.Set("client_id", config.Instance.GitHubOAuth.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("scope", "read:user user:email")
+	query.Set("state", state)
+	return githubBase() + "/login/oauth/authorize?" + query.Encode()
+}
+
+// GitHubExchange 使用授权码换取访问令牌并获取用户资料
+// 用户标识使用不可变的数字 id，登录名可被用户修改，只作为昵称
+func GitHubExchange(code, redirectURI string) (*Profile, error) {
+	cfg := config.Instance.GitHubOAuth
+	resp, err := client.R().
+		SetHeader("Accept", "application/json").
+		SetFormData(map[string]string{
+			"code":          code,
+			"client_id":     cfg.ClientID,
+			"client_secret": cfg.ClientSecret,
+			"redirect_uri":  redirectURI,
+		}).Post(githubBase() + "/login/oauth/access_token")
+	if err != nil {
+		return nil, err
+	}
+	accessToken := gjson.Get(resp.String(), "access_token").String()
+	if resp.IsError() || accessToken == "" {
+		return nil, fmt.Errorf("获取 GitHub 访问令牌失败: %s", resp.String())
+	}
+
+	resp, err = client.R().
+		SetHeader("Accept", "application/vnd.github+json").
+		SetAuthToken(accessToken).
+		Get(githubAPI() + "/user")
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("获取 GitHub 用户信息失败: %s", resp.String())
+	}
+
+	info := gjson.Parse(resp.String())
+	profile := &Profile{
+		Provider: "github",
+		Subject:  info.Get("id").String(),
+		Nickname: info.Get("name").String(),
+		Avatar:   info.Get("avatar_url").String(),
+	}
+	if profile.Subject == "" {
+		return nil, errors.New("GitHub 用户信息缺少 id 字段")
+	}
+	if profile.Nickname == "" {
+		profile.Nickname = info.Get("login").String()
+	}
+
+	// /user 返回的公开邮箱未必经过验证，以 /user/emails 中的主邮箱为准
+	resp, err = client.R().
+		SetHeader("Accept", "application/vnd.github+json").
+		SetAuthToken(accessToken).
+		Get(githubAPI() + "/user/emails")
+	if err == nil && !resp.IsError() {
+		gjson.Parse(resp.String()).ForEach(func(_, value gjson.Result) bool {
+			if value.Get("primary").Bool() {
+				profile.Email = value.Get("email").String()
+				profile.EmailVerified = value.Get("verified").Bool()
+				return false
+			}
+			return true
+		})
+	}
+	return profile, nil
+}
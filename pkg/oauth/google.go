@@ -0,0 +1,89 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"qlist/config"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	googleAuthURL     = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleTokenURL    = "https://oauth2.googleapis.com/token"
+	googleUserInfoURL = "https://openidconnect.googleapis.com/v1/userinfo"
+)
+
+// GoogleEnabled 判断是否配置了 Google 登录
+func GoogleEnabled() bool {
+	return config.Instance.GoogleOAuth.ClientID != "" && config.Instance.GoogleOAuth.ClientSecret != ""
+}
+
+// GoogleAuthCodeURL 生成跳转到 Google 授权页的地址
+func GoogleAuthCodeURL(state, redirectURI string) string {
+	cfg := config.Instance.GoogleOAuth
+	authURL := cfg.AuthURL
+	if authURL == "" {
+		authURL = googleAuthURL
+	}
+
+	query := url.Values{}
+	query.Set("client_id", cfg.ClientID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("response_type", "code")
+	query.Set("scope", "openid email profile")
+	query.Set("state", state)
+	query.Set("prompt", "select_account")
+	return authURL + "?" + query.Encode()
+}
+
+// GoogleExchange 使用授权码换取访问令牌并获取用户资料
+func GoogleExchange(code, redirectURI string) (*Profile, error) {
+	cfg := config.Instance.GoogleOAuth
+	tokenURL := cfg.TokenURL
+	if tokenURL == "" {
+		tokenURL = googleTokenURL
+	}
+	userInfoURL := cfg.UserInfoURL
+	if userInfoURL == "" {
+		userInfoURL = googleUserInfoURL
+	}
+
+	resp, err := client.R().SetFormData(map[string]string{
+		"code":          code,
+		"client_id":     cfg.ClientID,
+		"client_secret": cfg.ClientSecret,
+		"redirect_uri":  redirectURI,
+		"grant_type":    "authorization_code",
+	}).Post(tokenURL)
+	if err != nil {
+		return nil, err
+	}
+	accessToken := gjson.Get(resp.String(), "access_token").String()
+	if resp.IsError() || accessToken == "" {
+		return nil, fmt.Errorf("获取 Google 访问令牌失败: %s", resp.String())
+	}
+
+	resp, err = client.R().SetAuthToken(accessToken).Get(userInfoURL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("获取 Google 用户信息失败: %s", resp.String())
+	}
+
+	info := gjson.Parse(resp.String())
+	profile := &Profile{
+		Provider:      "google",
+		Subject:       info.Get("sub").String(),
+		Email:         info.Get("email").String(),
+		EmailVerified: info.Get("email_verified").Bool(),
+		Nickname:      info.Get("name").String(),
+		Avatar:        info.Get("picture").String(),
+	}
+	if profile.Subject == "" {
+		return nil, errors.New("Google 用户信息缺少 sub 字段")
+	}
+	return profile, nil
+}
@@ -0,0 +1,33 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Profile 三方登录渠道返回的用户资料
+type Profile struct {
+	Provider      string // 渠道名称 google/github/wechat
+	Subject       string // 渠道内不可变的用户标识
+	Email         string
+	EmailVerified bool
+	Nickname      string
+	Avatar        string
+	OpenID        string // 微信应用下的 openid，仅微信登录
+	UnionID       string // 微信开放平台下的 unionid，应用未绑定开放平台时为空，仅微信登录
+}
+
+// client 三方登录请求共用的 HTTP 客户端
+var client = resty.New().SetTimeout(15 * time.Second)
+
+// GenerateState 生成用于防止 CSRF 的随机 state
+func GenerateState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
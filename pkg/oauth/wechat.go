@@ -0,0 +1,102 @@
+package oauth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"qlist/config"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+const (
+	wechatOpenHost = "https://open.weixin.qq.com"
+	wechatAPIHost  = "https://api.weixin.qq.com"
+)
+
+// WechatEnabled 判断是否配置了微信扫码登录
+func WechatEnabled() bool {
+	return config.Instance.WechatOAuth.AppID != "" && config.Instance.WechatOAuth.AppSecret != ""
+}
+
+func wechatOpen() string {
+	if host := config.Instance.WechatOAuth.OpenHost; host != "" {
+		return strings.TrimRight(host, "/")
+	}
+	return wechatOpenHost
+}
+
+func wechatAPI() string {
+	if host := config.Instance.WechatOAuth.APIHost; host != "" {
+		return strings.TrimRight(host, "/")
+	}
+	return wechatAPIHost
+}
+
+// WechatAuthCodeURL 生成网站应用扫码登录页的地址
+func WechatAuthCodeURL(state, redirectURI string) string {
+	query := url.Values{}
+	query.Set("appid", config.Instance.WechatOAuth.AppID)
+	query.Set("redirect_uri", redirectURI)
+	query.Set("response_type", "code")
+	query.Set("scope", "snsapi_login")
+	query.Set("state", state)
+	return wechatOpen() + "/connect/qrconnect?" + query.Encode() + "#wechat_redirect"
+}
+
+// WechatExchange 使用授权码换取访问令牌并获取用户资料
+// openid 与 unionid 分别返回，由调用方按各自的字段匹配用户：同一主体的公众号、小程序登录通过 unionid 识别为同一用户，
+// 应用未绑定开放平台账号时没有 unionid，只按 openid 识别
+func WechatExchange(code string) (*Profile, error) {
+	cfg := config.Instance.WechatOAuth
+	resp, err := client.R().SetQueryParams(map[string]string{
+		"appid":      cfg.AppID,
+		"secret":     cfg.AppSecret,
+		"code":       code,
+		"grant_type": "authorization_code",
+	}).Get(wechatAPI() + "/sns/oauth2/access_token")
+	if err != nil {
+		return nil, err
+	}
+	result := gjson.Parse(resp.String())
+	if result.Get("errcode").Int() != 0 || result.Get("access_token").String() == "" {
+		return nil, fmt.Errorf("获取微信访问令牌失败: %s", resp.String())
+	}
+	accessToken := result.Get("access_token").String()
+	openID := result.Get("openid").String()
+	unionID := result.Get("unionid").String()
+
+	resp, err = client.R().SetQueryParams(map[string]string{
+		"access_token": accessToken,
+		"openid":       openID,
+	}).Get(wechatAPI() + "/sns/userinfo")
+	if err != nil {
+		return nil, err
+	}
+	info := gjson.Parse(resp.String())
+	if info.Get("errcode").Int() != 0 {
+		return nil, fmt.Errorf("获取微信用户信息失败: %s", resp.String())
+	}
+	if unionID == "" {
+		unionID = info.Get("unionid").String()
+	}
+
+	if openID == "" {
+		return nil, errors.New("微信用户信息缺少 openid")
+	}
+
+	// 新用户的用户名带上标识类型的前缀，openid 和 unionid 不会互相占用
+	profile := &Profile{
+		Provider: "wechat",
+		Subject:  "openid:" + openID,
+		Nickname: info.Get("nickname").String(),
+		Avatar:   info.Get("headimgurl").String(),
+		OpenID:   openID,
+		UnionID:  unionID,
+	}
+	if unionID != "" {
+		profile.Subject = "unionid:" + unionID
+	}
+	return profile, nil
+}
@@ -0,0 +1,81 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"qlist/config"
+	"strings"
+)
+
+// prefix 加密后的值带有该前缀，便于和未加密的历史数据区分
+const prefix = "enc:v1:"
+
+// key 由 encryption_key 派生 AES-256 密钥，未配置时使用 jwt_secret
+func key() ([]byte, error) {
+	source := config.Instance.EncryptionKey
+	if source == "" {
+		source = config.Instance.JWTSecret
+	}
+	if source == "" {
+		return nil, errors.New("未配置 encryption_key 或 jwt_secret")
+	}
+	sum := sha256.Sum256([]byte(source))
+	return sum[:], nil
+}
+
+// Encrypt 使用 AES-GCM 加密字符串，空字符串原样返回
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密 Encrypt 生成的字符串，没有加密前缀的值视为明文直接返回
+func Decrypt(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("密文长度不正确")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("解密失败，请检查 encryption_key 是否变更")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	k, err := key()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
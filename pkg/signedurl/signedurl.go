@@ -0,0 +1,87 @@
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"qlist/config"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalid 令牌格式错误或签名不匹配
+	ErrInvalid = errors.New("下载链接无效")
+	// ErrExpired 令牌已过期
+	ErrExpired = errors.New("下载链接已过期")
+)
+
+// Claims 下载令牌中绑定的信息
+type Claims struct {
+	UserID    uint   `json:"u"`
+	SiteID    uint   `json:"s"`
+	FileID    uint   `json:"f"`
+	Path      string `json:"p"`
+	ExpiresAt int64  `json:"e"`
+}
+
+// key 由 jwt_secret 派生签名密钥，与登录令牌的密钥区分开
+func key() ([]byte, error) {
+	if config.Instance.JWTSecret == "" {
+		return nil, errors.New("未配置 jwt_secret")
+	}
+	mac := hmac.New(sha256.New, []byte(config.Instance.JWTSecret))
+	mac.Write([]byte("qlist download link"))
+	return mac.Sum(nil), nil
+}
+
+// Sign 生成在 ttl 后过期的下载令牌，格式为 base64url(内容).base64url(签名)
+func Sign(claims Claims, ttl time.Duration) (string, error) {
+	k, err := key()
+	if err != nil {
+		return "", err
+	}
+	claims.ExpiresAt = time.Now().Add(ttl).Unix()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(k, encoded)), nil
+}
+
+// Verify 校验令牌的签名和有效期，返回其中绑定的信息
+func Verify(token string) (*Claims, error) {
+	k, err := key()
+	if err != nil {
+		return nil, err
+	}
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalid
+	}
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(got, sign(k, encoded)) {
+		return nil, ErrInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+	return &claims, nil
+}
+
+func sign(key []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,177 @@
+package wechatpay
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"qlist/config"
+	"strconv"
+	"time"
+)
+
+// TradeStateSuccess 支付成功的交易状态
+const TradeStateSuccess = "SUCCESS"
+
+// Transaction 回调通知中解密后的支付结果
+type Transaction struct {
+	AppID         string `json:"appid"`
+	MchID         string `json:"mchid"`
+	OutTradeNo    string `json:"out_trade_no"`   // 商户订单号
+	TransactionID string `json:"transaction_id"` // 微信支付订单号
+	TradeType     string `json:"trade_type"`     // NATIVE、JSAPI 等
+	TradeState    string `json:"trade_state"`
+	SuccessTime   string `json:"success_time"`
+	Payer         struct {
+		OpenID string `json:"openid"`
+	} `json:"payer"`
+	Amount struct {
+		Total      int64  `json:"total"`       // 订单金额（分）
+		PayerTotal int64  `json:"payer_total"` // 用户实际支付的金额（分），使用优惠券时小于订单金额
+		Currency   string `json:"currency"`
+	} `json:"amount"`
+}
+
+// notification 回调通知的外层结构，支付结果加密保存在 resource 中
+type notification struct {
+	ID           string `json:"id"`
+	EventType    string `json:"event_type"`
+	ResourceType string `json:"resource_type"`
+	Resource     struct {
+		Algorithm      string `json:"algorithm"`
+		Ciphertext     string `json:"ciphertext"`
+		AssociatedData string `json:"associated_data"`
+		Nonce          string `json:"nonce"`
+	} `json:"resource"`
+}
+
+// ParseNotification 校验回调通知的签名并解密支付结果
+// 支付结果的 appid 和 mchid 必须与配置一致，交易是否成功由调用方根据 TradeState 判断
+func ParseNotification(header http.Header, body []byte) (*Transaction, error) {
+	k, err := keys()
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(k, header, body); err != nil {
+		return nil, err
+	}
+
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("解析回调通知失败: %w", err)
+	}
+	if n.Resource.Algorithm != "AEAD_AES_256_GCM" {
+		return nil, fmt.Errorf("不支持的加密算法: %s", n.Resource.Algorithm)
+	}
+	plaintext, err := decrypt(k.apiV3Key, n.Resource.Nonce, n.Resource.AssociatedData, n.Resource.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	var transaction Transaction
+	if err := json.Unmarshal(plaintext, &transaction); err != nil {
+		return nil, fmt.Errorf("解析支付结果失败: %w", err)
+	}
+	cfg := config.Instance.WechatPay
+	if transaction.AppID != cfg.AppID || transaction.MchID != cfg.MchID {
+		return nil, errors.New("支付结果的 appid 或 mchid 与配置不一致")
+	}
+	return &transaction, nil
+}
+
+// decrypt 使用 APIv3 密钥解密回调通知中的 resource
+func decrypt(key []byte, nonceStr, associatedData, ciphertext string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("解密支付结果失败: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, []byte(nonceStr), data, []byte(associatedData))
+	if err != nil {
+		return nil, fmt.Errorf("解密支付结果失败: %w", err)
+	}
+	return plaintext, nil
+}
+
+// newGCM 创建 AES-256-GCM，回调通知使用 12 字节的随机串作为 nonce
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SimulateNotification 模拟微信支付的支付成功回调，返回与真实回调格式相同、已加密和签名的请求头和请求体
+// 只在模拟模式下可用，回调仍需经过 ParseNotification 校验
+func SimulateNotification(order Order, tradeType, openID string) (http.Header, []byte, error) {
+	if !Simulated() {
+		return nil, nil, errors.New("未启用微信支付模拟模式")
+	}
+	k, err := keys()
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := config.Instance.WechatPay
+
+	transaction := Transaction{
+		AppID:         cfg.AppID,
+		MchID:         cfg.MchID,
+		OutTradeNo:    order.OrderNo,
+		TransactionID: "4200000000" + time.Now().Format("20060102150405") + nonce()[:6],
+		TradeType:     tradeType,
+		TradeState:    TradeStateSuccess,
+		SuccessTime:   time.Now().Format("2006-01-02T15:04:05-07:00"),
+	}
+	transaction.Payer.OpenID = openID
+	transaction.Amount.Total = order.AmountCents
+	transaction.Amount.PayerTotal = order.AmountCents
+	transaction.Amount.Currency = "CNY"
+	plaintext, err := json.Marshal(transaction)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gcm, err := newGCM(k.apiV3Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonceBytes := make([]byte, 6)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return nil, nil, err
+	}
+	gcmNonce := fmt.Sprintf("%x", nonceBytes)
+	var n notification
+	n.ID = nonce()
+	n.EventType = "TRANSACTION.SUCCESS"
+	n.ResourceType = "encrypt-resource"
+	n.Resource.Algorithm = "AEAD_AES_256_GCM"
+	n.Resource.AssociatedData = "transaction"
+	n.Resource.Nonce = gcmNonce
+	n.Resource.Ciphertext = base64.StdEncoding.EncodeToString(gcm.Seal(nil, []byte(gcmNonce), plaintext, []byte("transaction")))
+	body, err := json.Marshal(n)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceStr := nonce()
+	signature, err := signMessage(k.platformKey, timestamp, nonceStr, string(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Wechatpay-Timestamp", timestamp)
+	header.Set("Wechatpay-Nonce", nonceStr)
+	header.Set("Wechatpay-Signature", signature)
+	header.Set("Wechatpay-Serial", k.publicKeyID)
+	return header, body, nil
+}
@@ -0,0 +1,118 @@
+package wechatpay
+
+import (
+	"errors"
+	"net/http"
+	"qlist/config"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// enableSimulator 开启模拟模式，密钥在进程内只生成一次
+func enableSimulator(t *testing.T) *keySet {
+	config.Instance.WechatPay.Simulate = true
+	config.Instance.WechatPay.AppID = "wx-test"
+	k, err := keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// resign 用模拟的平台私钥以指定时间戳重新签名
+func resign(t *testing.T, k *keySet, header http.Header, body []byte, at time.Time) http.Header {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	nonceStr := nonce()
+	signature, err := signMessage(k.platformKey, timestamp, nonceStr, string(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := header.Clone()
+	signed.Set("Wechatpay-Timestamp", timestamp)
+	signed.Set("Wechatpay-Nonce", nonceStr)
+	signed.Set("Wechatpay-Signature", signature)
+	return signed
+}
+
+// TestParseNotification 模拟的回调经签名校验和解密后还原支付结果，被篡改或过期的回调被拒绝
+func TestParseNotification(t *testing.T) {
+	k := enableSimulator(t)
+	order := Order{OrderNo: "20260101000000000001", Description: "积分充值", AmountCents: 1000}
+	header, body, err := SimulateNotification(order, "NATIVE", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		header  func() http.Header
+		body    func() []byte
+		wantErr error
+	}{
+		{
+			name: "原样校验通过",
+		},
+		{
+			name: "请求体被篡改",
+			body: func() []byte {
+				tampered := append([]byte(nil), body...)
+				tampered[len(tampered)-2] ^= 1
+				return tampered
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "签名被篡改",
+			header: func() http.Header {
+				tampered := header.Clone()
+				tampered.Set("Wechatpay-Nonce", tampered.Get("Wechatpay-Nonce")+"x")
+				return tampered
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "时间戳过期",
+			header: func() http.Header {
+				return resign(t, k, header, body, time.Now().Add(-maxClockSkew-time.Minute))
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name: "未知的公钥",
+			header: func() http.Header {
+				tampered := header.Clone()
+				tampered.Set("Wechatpay-Serial", "PUB_KEY_ID_OTHER")
+				return tampered
+			},
+			wantErr: ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, b := header, body
+			if tt.header != nil {
+				h = tt.header()
+			}
+			if tt.body != nil {
+				b = tt.body()
+			}
+
+			transaction, err := ParseNotification(h, b)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if transaction.OutTradeNo != order.OrderNo || transaction.Amount.Total != order.AmountCents ||
+				transaction.TradeState != TradeStateSuccess || transaction.TradeType != "NATIVE" {
+				t.Fatalf("支付结果与订单不一致: %+v", transaction)
+			}
+		})
+	}
+}
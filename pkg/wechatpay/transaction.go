@@ -0,0 +1,114 @@
+package wechatpay
+
+import (
+	"encoding/json"
+	"errors"
+	"qlist/config"
+	"strconv"
+	"time"
+)
+
+// Order 下单所需的订单信息
+type Order struct {
+	OrderNo     string    // 商户订单号
+	Description string    // 商品描述，展示在用户的支付页和账单中
+	AmountCents int64     // 金额（分）
+	ExpiresAt   time.Time // 超过此时间后用户无法再支付
+}
+
+// JSAPIParams 前端调起 JSAPI 支付所需的参数，原样传给 WeixinJSBridge 的 getBrandWCPayRequest
+type JSAPIParams struct {
+	AppID     string `json:"appId"`
+	TimeStamp string `json:"timeStamp"`
+	NonceStr  string `json:"nonceStr"`
+	Package   string `json:"package"`
+	SignType  string `json:"signType"`
+	PaySign   string `json:"paySign"`
+}
+
+// CreateNative 创建 Native 支付订单，返回用于生成二维码的 code_url
+func CreateNative(order Order) (string, error) {
+	if Simulated() {
+		return "weixin://wxpay/bizpayurl?pr=SIMULATOR" + order.OrderNo, nil
+	}
+
+	body, err := json.Marshal(transactionBody(order, ""))
+	if err != nil {
+		return "", err
+	}
+	result, err := request("POST", "/v3/pay/transactions/native", body)
+	if err != nil {
+		return "", err
+	}
+	codeURL := result.Get("code_url").String()
+	if codeURL == "" {
+		return "", errors.New("微信支付未返回 code_url")
+	}
+	return codeURL, nil
+}
+
+// CreateJSAPI 创建 JSAPI 支付订单，openID 为用户在配置的 appid 下的 openid，返回前端调起支付的参数
+func CreateJSAPI(order Order, openID string) (*JSAPIParams, error) {
+	k, err := keys()
+	if err != nil {
+		return nil, err
+	}
+
+	prepayID := "wx_simulator_" + order.OrderNo
+	if !Simulated() {
+		body, err := json.Marshal(transactionBody(order, openID))
+		if err != nil {
+			return nil, err
+		}
+		result, err := request("POST", "/v3/pay/transactions/jsapi", body)
+		if err != nil {
+			return nil, err
+		}
+		if prepayID = result.Get("prepay_id").String(); prepayID == "" {
+			return nil, errors.New("微信支付未返回 prepay_id")
+		}
+	}
+
+	params := &JSAPIParams{
+		AppID:     config.Instance.WechatPay.AppID,
+		TimeStamp: strconv.FormatInt(time.Now().Unix(), 10),
+		NonceStr:  nonce(),
+		Package:   "prepay_id=" + prepayID,
+		SignType:  "RSA",
+	}
+	params.PaySign, err = signMessage(k.privateKey, params.AppID, params.TimeStamp, params.NonceStr, params.Package)
+	if err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+// transactionBody 生成下单请求体，openID 不为空时为 JSAPI 下单
+func transactionBody(order Order, openID string) map[string]interface{} {
+	cfg := config.Instance.WechatPay
+	body := map[string]interface{}{
+		"appid":        cfg.AppID,
+		"mchid":        cfg.MchID,
+		"description":  truncate(order.Description, 127),
+		"out_trade_no": order.OrderNo,
+		"time_expire":  order.ExpiresAt.Format("2006-01-02T15:04:05-07:00"),
+		"notify_url":   cfg.NotifyURL,
+		"amount": map[string]interface{}{
+			"total":    order.AmountCents,
+			"currency": "CNY",
+		},
+	}
+	if openID != "" {
+		body["payer"] = map[string]string{"openid": openID}
+	}
+	return body
+}
+
+// truncate 按字符截断字符串
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
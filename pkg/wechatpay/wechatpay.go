@@ -0,0 +1,264 @@
+package wechatpay
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"qlist/config"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	apiHost = "https://api.mch.weixin.qq.com"
+	// authSchema 请求签名使用的认证类型
+	authSchema = "WECHATPAY2-SHA256-RSA2048"
+	// maxClockSkew 应答和回调的时间戳与本地时间允许的最大偏差，超出视为重放
+	maxClockSkew = 5 * time.Minute
+)
+
+// ErrInvalidSignature 应答或回调的签名校验失败
+var ErrInvalidSignature = errors.New("微信支付签名校验失败")
+
+// client 微信支付请求共用的 HTTP 客户端
+var client = resty.New().SetTimeout(15 * time.Second)
+
+// keySet 签名和验签使用的密钥
+type keySet struct {
+	privateKey  *rsa.PrivateKey // 商户 API 私钥，用于请求签名
+	serialNo    string          // 商户 API 证书序列号
+	publicKey   *rsa.PublicKey  // 微信支付公钥，用于验证应答和回调
+	publicKeyID string          // 微信支付公钥 ID，与应答头 Wechatpay-Serial 对应
+	apiV3Key    []byte          // 解密回调通知的 APIv3 密钥
+
+	// 模拟模式下代替微信支付签发回调的私钥，与 publicKey 成对
+	platformKey *rsa.PrivateKey
+}
+
+var (
+	keysOnce sync.Once
+	keysVal  *keySet
+	keysErr  error
+)
+
+// Enabled 判断是否配置了微信支付
+func Enabled() bool {
+	cfg := config.Instance.WechatPay
+	if cfg.Simulate {
+		return true
+	}
+	return cfg.AppID != "" && cfg.MchID != "" && cfg.SerialNo != "" && cfg.PrivateKeyPath != "" &&
+		cfg.APIv3Key != "" && cfg.PublicKeyID != "" && cfg.PublicKeyPath != ""
+}
+
+// CheckConfig 检查支付配置，模拟模式不能与真实商户凭据同时配置，避免生产商户误开模拟支付
+func CheckConfig() error {
+	cfg := config.Instance.WechatPay
+	if cfg.Simulate && (cfg.MchID != "" || cfg.SerialNo != "" || cfg.PrivateKeyPath != "" ||
+		cfg.APIv3Key != "" || cfg.PublicKeyID != "" || cfg.PublicKeyPath != "") {
+		return errors.New("微信支付模拟模式不能与商户凭据同时配置")
+	}
+	return nil
+}
+
+// Simulated 判断是否处于模拟模式
+func Simulated() bool {
+	return config.Instance.WechatPay.Simulate
+}
+
+func host() string {
+	if h := config.Instance.WechatPay.APIHost; h != "" {
+		return strings.TrimRight(h, "/")
+	}
+	return apiHost
+}
+
+// keys 加载密钥，模拟模式下在进程内生成一套商户和平台密钥
+func keys() (*keySet, error) {
+	keysOnce.Do(func() {
+		cfg := config.Instance.WechatPay
+		if cfg.Simulate {
+			keysVal, keysErr = simulatorKeys()
+			return
+		}
+		if len(cfg.APIv3Key) != 32 {
+			keysErr = errors.New("微信支付 APIv3 密钥长度必须为 32 字节")
+			return
+		}
+		privateKey, err := loadPrivateKey(cfg.PrivateKeyPath)
+		if err != nil {
+			keysErr = fmt.Errorf("加载商户 API 私钥失败: %w", err)
+			return
+		}
+		publicKey, err := loadPublicKey(cfg.PublicKeyPath)
+		if err != nil {
+			keysErr = fmt.Errorf("加载微信支付公钥失败: %w", err)
+			return
+		}
+		keysVal = &keySet{
+			privateKey:  privateKey,
+			serialNo:    cfg.SerialNo,
+			publicKey:   publicKey,
+			publicKeyID: cfg.PublicKeyID,
+			apiV3Key:    []byte(cfg.APIv3Key),
+		}
+	})
+	return keysVal, keysErr
+}
+
+// simulatorKeys 生成模拟模式使用的密钥，未配置 APIv3 密钥时随机生成
+func simulatorKeys() (*keySet, error) {
+	merchantKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	platformKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	apiV3Key := []byte(config.Instance.WechatPay.APIv3Key)
+	if len(apiV3Key) != 32 {
+		apiV3Key = []byte(nonce())
+	}
+	return &keySet{
+		privateKey:  merchantKey,
+		serialNo:    "SIMULATOR",
+		publicKey:   &platformKey.PublicKey,
+		publicKeyID: "PUB_KEY_ID_SIMULATOR",
+		apiV3Key:    apiV3Key,
+		platformKey: platformKey,
+	}, nil
+}
+
+func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("私钥文件不是 PEM 格式")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("私钥不是 RSA 密钥")
+	}
+	return rsaKey, nil
+}
+
+func loadPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("公钥文件不是 PEM 格式")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("公钥不是 RSA 密钥")
+	}
+	return rsaKey, nil
+}
+
+// nonce 生成 32 位随机字符串
+func nonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// signMessage 使用私钥对按行拼接的字段签名，每个字段后都以换行结尾
+func signMessage(key *rsa.PrivateKey, fields ...string) (string, error) {
+	hashed := sha256.Sum256([]byte(strings.Join(fields, "\n") + "\n"))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// verify 校验应答或回调的签名，header 需包含 Wechatpay-Timestamp、Wechatpay-Nonce、Wechatpay-Signature 和 Wechatpay-Serial
+func verify(k *keySet, header interface{ Get(string) string }, body []byte) error {
+	timestamp := header.Get("Wechatpay-Timestamp")
+	nonceStr := header.Get("Wechatpay-Nonce")
+	signature, err := base64.StdEncoding.DecodeString(header.Get("Wechatpay-Signature"))
+	if err != nil || timestamp == "" || nonceStr == "" {
+		return ErrInvalidSignature
+	}
+	if header.Get("Wechatpay-Serial") != k.publicKeyID {
+		return fmt.Errorf("%w: 未知的公钥 %s", ErrInvalidSignature, header.Get("Wechatpay-Serial"))
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if skew := time.Since(time.Unix(seconds, 0)); skew > maxClockSkew || skew < -maxClockSkew {
+		return fmt.Errorf("%w: 时间戳已过期", ErrInvalidSignature)
+	}
+
+	hashed := sha256.Sum256([]byte(timestamp + "\n" + nonceStr + "\n" + string(body) + "\n"))
+	if err := rsa.VerifyPKCS1v15(k.publicKey, crypto.SHA256, hashed[:], signature); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// request 发送签名后的请求并校验应答签名，返回应答内容
+func request(method, path string, body []byte) (gjson.Result, error) {
+	k, err := keys()
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	cfg := config.Instance.WechatPay
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceStr := nonce()
+	signature, err := signMessage(k.privateKey, method, path, timestamp, nonceStr, string(body))
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	authorization := fmt.Sprintf(`%s mchid="%s",nonce_str="%s",signature="%s",timestamp="%s",serial_no="%s"`,
+		authSchema, cfg.MchID, nonceStr, signature, timestamp, k.serialNo)
+
+	req := client.R().
+		SetHeader("Authorization", authorization).
+		SetHeader("Accept", "application/json")
+	if body != nil {
+		req.SetHeader("Content-Type", "application/json").SetBody(body)
+	}
+	resp, err := req.Execute(method, host()+path)
+	if err != nil {
+		return gjson.Result{}, err
+	}
+	result := gjson.ParseBytes(resp.Body())
+	if resp.IsError() {
+		return result, fmt.Errorf("微信支付请求失败: %s %s", result.Get("code").String(), result.Get("message").String())
+	}
+	if err := verify(k, resp.Header(), resp.Body()); err != nil {
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,141 @@
+package pricing
+
+import (
+	"path"
+	"qlist/config"
+	"qlist/db"
+	"qlist/models"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 价格来源，优先级从高到低
+const (
+	SourceFile    = "file"    // 单文件积分配置
+	SourceRule    = "rule"    // 目录或通配符规则
+	SourceDefault = "default" // 未配置时使用的默认积分
+)
+
+// Price 文件价格解析结果
+type Price struct {
+	Path        string       `json:"path"`
+	Points      int          `json:"points"`
+	Source      string       `json:"source"`
+	ConfigID    uint         `json:"configId,omitempty"`
+	RuleID      uint         `json:"ruleId,omitempty"`
+	Rule        string       `json:"rule,omitempty"` // 命中的规则，便于管理员排查价格
+	Description string       `json:"description,omitempty"`
+	File        *models.File `json:"file,omitempty"` // 文件尚未入库时为空
+}
+
+// Resolver 站点价格解析器，创建时加载一次定价规则，适合批量解析
+type Resolver struct {
+	siteID uint
+	rules  []models.PriceRule
+}
+
+// NewResolver 创建站点价格解析器
+func NewResolver(siteID uint) (*Resolver, error) {
+	var rules []models.PriceRule
+	if err := db.GetDB().Where("site_id = ?", siteID).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return &Resolver{siteID: siteID, rules: rules}, nil
+}
+
+// NormalizePath 统一路径格式：以 / 开头，去掉多余的分隔符和 . / ..
+func NormalizePath(p string) string {
+	return path.Clean("/" + strings.TrimSpace(p))
+}
+
+// Resolve 将请求路径解析为文件及其价格，文件不在 files 表中时同样可以定价
+func Resolve(siteID uint, filePath string) (*Price, error) {
+	resolver, err := NewResolver(siteID)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.Resolve(filePath)
+}
+
+// ResolveFile 解析已入库文件的价格
+func ResolveFile(siteID uint, file *models.File) (*Price, error) {
+	resolver, err := NewResolver(siteID)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.ResolveFile(file)
+}
+
+// Resolve 将请求路径解析为文件及其价格
+func (r *Resolver) Resolve(filePath string) (*Price, error) {
+	filePath = NormalizePath(filePath)
+
+	var file models.File
+	err := db.GetDB().Where("site_id = ? AND path = ?", r.siteID, filePath).First(&file).Error
+	if err == gorm.ErrRecordNotFound {
+		return r.resolve(filePath, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.resolve(filePath, &file)
+}
+
+// ResolveFile 解析已入库文件的价格
+func (r *Resolver) ResolveFile(file *models.File) (*Price, error) {
+	return r.resolve(NormalizePath(file.Path), file)
+}
+
+// resolve 依次查找单文件配置、最具体的规则和默认积分
+func (r *Resolver) resolve(filePath string, file *models.File) (*Price, error) {
+	price := &Price{Path: filePath, File: file}
+
+	query := db.GetDB().Where("site_id = ?", r.siteID)
+	if file != nil {
+		query = query.Where("path = ? OR file_id = ?", filePath, file.ID)
+	} else {
+		query = query.Where("path = ?", filePath)
+	}
+
+	var pointConfig models.PointConfig
+	err := query.First(&pointConfig).Error
+	if err == nil {
+		price.Points = pointConfig.Points
+		price.Source = SourceFile
+		price.ConfigID = pointConfig.ID
+		price.Description = pointConfig.Description
+		return price, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	if rule := r.matchRule(filePath); rule != nil {
+		price.Points = rule.Points
+		price.Source = SourceRule
+		price.RuleID = rule.ID
+		price.Rule = rule.Pattern
+		price.Description = rule.Description
+		return price, nil
+	}
+
+	price.Points = config.Instance.DefaultPoints
+	price.Source = SourceDefault
+	return price, nil
+}
+
+// matchRule 返回匹配路径的规则中最具体的一条
+func (r *Resolver) matchRule(filePath string) *models.PriceRule {
+	var best *models.PriceRule
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if !ruleMatches(rule.Pattern, filePath) {
+			continue
+		}
+		if best == nil || moreSpecific(rule, best) {
+			best = rule
+		}
+	}
+	return best
+}
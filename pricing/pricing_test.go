@@ -0,0 +1,85 @@
+package pricing
+
+import (
+	"path/filepath"
+	"qlist/config"
+	"qlist/db"
+	"qlist/models"
+	"testing"
+)
+
+// TestResolve 单文件配置优先，其次是匹配的规则中最具体的一条，都没有时使用默认积分
+func TestResolve(t *testing.T) {
+	const defaultPoints = 1
+
+	config.Instance = config.AppConfig{
+		DBType:        "sqlite",
+		DBConn:        filepath.Join(t.TempDir(), "qlist.db"),
+		JWTSecret:     "test-secret",
+		DefaultPoints: defaultPoints,
+	}
+	if err := db.InitDB(); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	site := models.Site{Name: "test", Domain: "example.com"}
+	if err := db.GetDB().Create(&site).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 按顺序创建，特异性相同的规则后创建的优先
+	rules := []models.PriceRule{
+		{Pattern: "/courses", Points: 10},
+		{Pattern: "/courses/**/*.mp4", Points: 20},
+		{Pattern: "/courses/vip/intro.mp4", Points: 5},
+		{Pattern: "/**/*.pdf", Points: 3},
+		{Pattern: "/videos/*.mp4", Points: 7},
+		{Pattern: "/videos/?.mp4", Points: 8},
+	}
+	for i := range rules {
+		rules[i].SiteID = site.ID
+		if err := db.GetDB().Create(&rules[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.GetDB().Create(&models.PointConfig{SiteID: site.ID, Path: "/courses/free.mp4", Points: 0}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantPoints int
+		wantSource string
+		wantRule   string
+	}{
+		{name: "** 规则比目录前缀具体", path: "/courses/a/b/lesson.mp4", wantPoints: 20, wantSource: SourceRule, wantRule: "/courses/**/*.mp4"},
+		{name: "** 匹配零层目录", path: "/courses/lesson.mp4", wantPoints: 20, wantSource: SourceRule, wantRule: "/courses/**/*.mp4"},
+		{name: "精确路径比 ** 规则具体", path: "/courses/vip/intro.mp4", wantPoints: 5, wantSource: SourceRule, wantRule: "/courses/vip/intro.mp4"},
+		{name: "只匹配目录前缀", path: "/courses/notes.txt", wantPoints: 10, wantSource: SourceRule, wantRule: "/courses"},
+		{name: "目录前缀比通配扩展名具体", path: "/courses/slides.pdf", wantPoints: 10, wantSource: SourceRule, wantRule: "/courses"},
+		{name: "通配扩展名", path: "/docs/a/manual.pdf", wantPoints: 3, wantSource: SourceRule, wantRule: "/**/*.pdf"},
+		{name: "特异性相同时后创建的优先", path: "/videos/a.mp4", wantPoints: 8, wantSource: SourceRule, wantRule: "/videos/?.mp4"},
+		{name: "单段通配不跨目录", path: "/videos/sub/a.mp4", wantPoints: defaultPoints, wantSource: SourceDefault},
+		{name: "目录前缀不匹配同名前缀的目录", path: "/coursesX/lesson.mp4", wantPoints: defaultPoints, wantSource: SourceDefault},
+		{name: "没有匹配的规则", path: "/other/readme.md", wantPoints: defaultPoints, wantSource: SourceDefault},
+		{name: "单文件配置优先于规则", path: "/courses/free.mp4", wantPoints: 0, wantSource: SourceFile},
+		{name: "路径先规范化", path: "courses//a/../lesson.mp4", wantPoints: 20, wantSource: SourceRule, wantRule: "/courses/**/*.mp4"},
+	}
+
+	resolver, err := NewResolver(site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, err := resolver.Resolve(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if price.Points != tt.wantPoints || price.Source != tt.wantSource || price.Rule != tt.wantRule {
+				t.Fatalf("%s 解析为 %d 积分（%s %q），期望 %d 积分（%s %q）",
+					tt.path, price.Points, price.Source, price.Rule, tt.wantPoints, tt.wantSource, tt.wantRule)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package pricing
+
+import (
+	"errors"
+	"path"
+	"qlist/models"
+	"strings"
+)
+
+// ErrInvalidPattern 规则格式不正确
+var ErrInvalidPattern = errors.New("规则必须以 / 开头，且通配符格式正确")
+
+// NormalizePattern 校验并规范化定价规则
+// 不含通配符的规则视为目录前缀，含 * ? [ 的规则视为通配符，** 可匹配任意层级目录
+func NormalizePattern(pattern string) (string, error) {
+	pattern = strings.TrimSpace(pattern)
+	if !strings.HasPrefix(pattern, "/") {
+		return "", ErrInvalidPattern
+	}
+	if !isGlob(pattern) {
+		return path.Clean(pattern), nil
+	}
+	for _, segment := range strings.Split(strings.Trim(pattern, "/"), "/") {
+		if segment == "**" {
+			continue
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return "", ErrInvalidPattern
+		}
+	}
+	return pattern, nil
+}
+
+// Match 判断目录前缀或通配符规则是否匹配路径，规则格式与定价规则相同
+func Match(pattern, filePath string) bool {
+	return ruleMatches(pattern, filePath)
+}
+
+// ruleMatches 判断规则是否匹配文件路径
+func ruleMatches(pattern, filePath string) bool {
+	if !isGlob(pattern) {
+		return pattern == "/" || filePath == pattern || strings.HasPrefix(filePath, pattern+"/")
+	}
+	return matchSegments(splitPath(pattern), splitPath(filePath))
+}
+
+// matchSegments 逐段匹配，** 可以匹配零个或多个目录
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// specificity 计算规则的特异性，字面字符越多越具体，其次比较层级数
+func specificity(pattern string) (int, int) {
+	literal := 0
+	for _, r := range pattern {
+		switch r {
+		case '*', '?', '[', ']', '/':
+		default:
+			literal++
+		}
+	}
+	return literal, len(splitPath(pattern))
+}
+
+// moreSpecific 判断规则 a 是否比 b 更具体，特异性相同时新建的规则优先
+func moreSpecific(a, b *models.PriceRule) bool {
+	aLiteral, aDepth := specificity(a.Pattern)
+	bLiteral, bDepth := specificity(b.Pattern)
+	if aLiteral != bLiteral {
+		return aLiteral > bLiteral
+	}
+	if aDepth != bDepth {
+		return aDepth > bDepth
+	}
+	return a.ID > b.ID
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
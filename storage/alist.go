@@ -1,113 +1,357 @@
 package storage
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"path"
 	"qlist/config"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/tidwall/gjson"
 )
 
-type AlistUploader struct {
+func init() {
+	Register("alist", func(cfg config.StorageConfig) (Driver, error) {
+		return NewAlistUploader(cfg), nil
+	})
 }
 
-var (
-	Host     = ""
-	Username = ""
-	Password = ""
+const (
+	// alistTokenTTL 无法从令牌中解析过期时间时假定的有效期，Alist 默认为 48 小时
+	alistTokenTTL = 24 * time.Hour
+	// alistTokenRefreshAhead 令牌过期前提前刷新的时间
+	alistTokenRefreshAhead = 5 * time.Minute
 )
 
-func Init() {
-	Host = config.Instance.Alist.Host
-	Username = config.Instance.Alist.Username
-	Password = config.Instance.Alist.Password
+// errAlistUnauthorized Alist 返回令牌无效或已过期
+var errAlistUnauthorized = errors.New("Alist 令牌无效或已过期")
+
+// AlistUploader 基于 Alist v3 API 的存储驱动，需通过 NewAlistUploader 创建
+type AlistUploader struct {
+	Host     string
+	Username string
+	Password string
+	Root     string // 驱动可访问的根路径，所有路径都限制在该目录下
+
+	client         *resty.Client
+	mu             sync.Mutex
+	token          string
+	tokenExpiresAt time.Time
 }
 
-func (a *AlistUploader) GetToken() (string, error) {
-	resp, err := resty.New().R().SetBody(map[string]interface{}{
-		"username": Username,
-		"password": Password,
-	}).Post(Host + "/api/auth/login")
+// alistRetryAPIs 失败后可以重试的只读接口，删除、移动等接口重试可能重复执行
+var alistRetryAPIs = []string{"/api/auth/login", "/api/fs/get", "/api/fs/list"}
 
-	if err != nil {
-		return "", err
+// NewAlistUploader 根据配置创建 Alist 驱动，所有请求共用一个带超时的客户端，只读接口失败时重试
+func NewAlistUploader(cfg config.StorageConfig) *AlistUploader {
+	client := resty.New().
+		SetTimeout(30 * time.Second).
+		SetRetryCount(2).
+		SetRetryWaitTime(500 * time.Millisecond).
+		AddRetryCondition(func(resp *resty.Response, err error) bool {
+			if resp == nil || resp.Request == nil || !alistRetryable(resp.Request.URL) {
+				return false
+			}
+			return err != nil || resp.StatusCode() >= http.StatusInternalServerError
+		})
+	return &AlistUploader{
+		Host:     strings.TrimRight(cfg.Endpoint, "/"),
+		Username: cfg.Username,
+		Password: cfg.Password,
+		Root:     path.Clean("/" + cfg.Root),
+		client:   client,
 	}
-	return gjson.Get(resp.String(), "data.token").String(), nil
 }
 
-func (a *AlistUploader) PutObject(key string, data []byte, contentType string) (string, error) {
-	token, err := a.GetToken()
+// alistRetryable 判断请求的接口是否可以重试，Alist 可能部署在子路径下，按路径后缀匹配
+func alistRetryable(rawURL string) bool {
+	u, err := url.Parse(rawURL)
 	if err != nil {
-		return "", err
+		return false
 	}
-	resp, err := resty.New().R().
-		SetHeader("File-Path", url.PathEscape(key)).
-		SetHeader("Content-Type", contentType).
-		SetHeader("Authorization", token).
-		SetBody(data).Put(Host + "/api/fs/put")
+	for _, api := range alistRetryAPIs {
+		if strings.HasSuffix(u.Path, api) {
+			return true
+		}
+	}
+	return false
+}
+
+// remotePath 将存储路径转换为 Alist 中的路径，先规整路径去掉 .. 再拼接根路径
+func (a *AlistUploader) remotePath(p string) string {
+	return path.Join("/", a.Root, path.Clean("/"+p))
+}
+
+// GetToken 返回缓存的令牌，令牌即将过期或已失效时重新登录
+func (a *AlistUploader) GetToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && time.Now().Before(a.tokenExpiresAt.Add(-alistTokenRefreshAhead)) {
+		return a.token, nil
+	}
+
+	resp, err := a.client.R().SetBody(map[string]interface{}{
+		"username": a.Username,
+		"password": a.Password,
+	}).Post(a.Host + "/api/auth/login")
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("Alist 登录失败: %w", err)
 	}
 
-	if gjson.Get(resp.String(), "code").Int() != 200 {
-		return "", errors.New(resp.String())
+	result := gjson.Parse(resp.String())
+	token := result.Get("data.token").String()
+	if result.Get("code").Int() != 200 || token == "" {
+		message := result.Get("message").String()
+		if message == "" {
+			message = resp.String()
+		}
+		return "", fmt.Errorf("Alist 登录失败: %s", message)
 	}
 
-	return key, nil
+	a.token = token
+	a.tokenExpiresAt = alistTokenExpiry(token)
+	return token, nil
 }
-func (a *AlistUploader) CopyImage(originUrl string) (string, error) {
-	return "", nil
+
+// invalidateToken 令牌被 Alist 拒绝后丢弃缓存，其他请求已刷新过的令牌不受影响
+func (a *AlistUploader) invalidateToken(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token == token {
+		a.token = ""
+	}
 }
 
-// GetFileList 获取指定目录下的文件列表
-func (a *AlistUploader) GetFileList(path string) ([]map[string]interface{}, error) {
-	token, err := a.GetToken()
+// alistTokenExpiry 从 Alist 签发的 JWT 中读取过期时间
+func alistTokenExpiry(token string) time.Time {
+	claims := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err == nil && claims.ExpiresAt != nil {
+		return claims.ExpiresAt.Time
+	}
+	return time.Now().Add(alistTokenTTL)
+}
+
+// call 调用 Alist 接口，返回响应中的 data 字段，令牌失效时重新登录并重试一次
+func (a *AlistUploader) call(ctx context.Context, api string, body interface{}) (gjson.Result, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := a.GetToken()
+		if err != nil {
+			return gjson.Result{}, err
+		}
+		resp, err := a.client.R().
+			SetContext(ctx).
+			SetHeader("Authorization", token).
+			SetBody(body).
+			Post(a.Host + api)
+		if err != nil {
+			return gjson.Result{}, err
+		}
+
+		data, err := parseAlistResponse(resp.StatusCode(), resp.String())
+		if err == errAlistUnauthorized && attempt == 0 {
+			a.invalidateToken(token)
+			continue
+		}
+		return data, err
+	}
+}
+
+// parseAlistResponse 检查 Alist 响应的业务状态码
+func parseAlistResponse(statusCode int, body string) (gjson.Result, error) {
+	result := gjson.Parse(body)
+	code := result.Get("code").Int()
+	if statusCode == http.StatusUnauthorized || code == http.StatusUnauthorized {
+		return gjson.Result{}, errAlistUnauthorized
+	}
+	if code != 200 {
+		message := result.Get("message").String()
+		if strings.Contains(message, "not found") {
+			return gjson.Result{}, ErrNotFound
+		}
+		return gjson.Result{}, errors.New(body)
+	}
+	return result.Get("data"), nil
+}
+
+// List 获取指定目录下的文件列表
+func (a *AlistUploader) List(ctx context.Context, dir string) ([]Object, error) {
+	data, err := a.call(ctx, "/api/fs/list", map[string]interface{}{
+		"path":     a.remotePath(dir),
+		"page":     1,
+		"per_page": 0,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := resty.New().R().
-		SetHeader("Authorization", token).
-		Get(Host + "/api/fs/list?path=" + url.PathEscape(path))
+	var objects []Object
+	data.Get("content").ForEach(func(_, value gjson.Result) bool {
+		objects = append(objects, alistObject(dir, value))
+		return true
+	})
+	return objects, nil
+}
+
+// Stat 获取文件或目录信息
+func (a *AlistUploader) Stat(ctx context.Context, filePath string) (*Object, error) {
+	data, err := a.call(ctx, "/api/fs/get", map[string]interface{}{"path": a.remotePath(filePath)})
 	if err != nil {
 		return nil, err
 	}
+	object := alistObject(path.Dir(filePath), data)
+	return &object, nil
+}
 
-	if gjson.Get(resp.String(), "code").Int() != 200 {
-		return nil, errors.New(resp.String())
+// Link 获取文件的直链地址
+func (a *AlistUploader) Link(ctx context.Context, filePath string) (string, error) {
+	data, err := a.call(ctx, "/api/fs/get", map[string]interface{}{"path": a.remotePath(filePath)})
+	if err != nil {
+		return "", err
 	}
+	if data.Get("is_dir").Bool() {
+		return "", fmt.Errorf("%s 是目录", filePath)
+	}
+	return data.Get("raw_url").String(), nil
+}
 
-	var files []map[string]interface{}
-	gjson.Get(resp.String(), "data.content").ForEach(func(key, value gjson.Result) bool {
-		file := make(map[string]interface{})
-		file["name"] = value.Get("name").String()
-		file["path"] = path + "/" + value.Get("name").String()
-		file["size"] = value.Get("size").Int()
-		file["is_dir"] = value.Get("is_dir").Bool()
-		file["modified"] = value.Get("modified").String()
-		files = append(files, file)
-		return true
-	})
+// Open 读取文件内容，由服务端向 Alist 的直链发起 Range 请求，直链不会暴露给客户端
+func (a *AlistUploader) Open(ctx context.Context, filePath string) (io.ReadSeekCloser, *Object, error) {
+	data, err := a.call(ctx, "/api/fs/get", map[string]interface{}{"path": a.remotePath(filePath)})
+	if err != nil {
+		return nil, nil, err
+	}
+	object := alistObject(path.Dir(path.Clean("/"+filePath)), data)
+	if object.IsDir {
+		return nil, nil, fmt.Errorf("%s 是目录", filePath)
+	}
+	rawURL := data.Get("raw_url").String()
+	if rawURL == "" {
+		return nil, nil, errors.New("Alist 未返回文件直链")
+	}
+	if strings.HasPrefix(rawURL, "/") {
+		rawURL = a.Host + rawURL
+	}
 
-	return files, nil
+	fetch := func(ctx context.Context, header http.Header) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		// 文件可能很大，不使用带整体超时的 resty 客户端
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 300 {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusNotFound {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("读取 Alist 文件失败: %s", resp.Status)
+		}
+		return resp, nil
+	}
+	return newRangeFile(ctx, object.Size, fetch), &object, nil
 }
 
-func (a *AlistUploader) GetDownloadUrl(key string) (string, error) {
+// Put 以流的方式上传文件
+func (a *AlistUploader) Put(ctx context.Context, filePath string, r io.Reader, size int64, contentType string) error {
 	token, err := a.GetToken()
 	if err != nil {
-		return "", err
+		return err
 	}
-	resp, err := resty.New().R().
-		SetHeader("Authorization", token).
-		Get(Host + "/api/fs/get?path=" + url.PathEscape(key))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, a.Host+"/api/fs/put", r)
 	if err != nil {
-		return "", err
+		return err
 	}
+	req.ContentLength = size
+	req.Header.Set("File-Path", url.PathEscape(a.remotePath(filePath)))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", token)
 
-	if gjson.Get(resp.String(), "code").Int() != 200 {
-		return "", errors.New(resp.String())
+	// 上传的数据流无法重放，不使用带整体超时和重试的 resty 客户端
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	_, err = parseAlistResponse(resp.StatusCode, string(body))
+	if err == errAlistUnauthorized {
+		a.invalidateToken(token)
+	}
+	return err
+}
+
+// Delete 删除文件或目录
+func (a *AlistUploader) Delete(ctx context.Context, filePath string) error {
+	if path.Clean("/"+filePath) == "/" {
+		return errors.New("不能删除存储根目录")
+	}
+	_, err := a.call(ctx, "/api/fs/remove", map[string]interface{}{
+		"dir":   path.Dir(a.remotePath(filePath)),
+		"names": []string{path.Base(a.remotePath(filePath))},
+	})
+	return err
+}
+
+// Move 移动文件，目标文件名不同时再重命名
+func (a *AlistUploader) Move(ctx context.Context, src, dst string) error {
+	srcDir, srcName := path.Split(a.remotePath(src))
+	dstDir, dstName := path.Split(a.remotePath(dst))
+
+	if path.Clean(srcDir) != path.Clean(dstDir) {
+		if _, err := a.call(ctx, "/api/fs/move", map[string]interface{}{
+			"src_dir": path.Clean(srcDir),
+			"dst_dir": path.Clean(dstDir),
+			"names":   []string{srcName},
+		}); err != nil {
+			return err
+		}
+	}
+	if srcName != dstName {
+		if _, err := a.call(ctx, "/api/fs/rename", map[string]interface{}{
+			"path": path.Join(dstDir, srcName),
+			"name": dstName,
+		}); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// MakeDir 创建目录
+func (a *AlistUploader) MakeDir(ctx context.Context, dir string) error {
+	_, err := a.call(ctx, "/api/fs/mkdir", map[string]interface{}{"path": a.remotePath(dir)})
+	return err
+}
 
-	return gjson.Get(resp.String(), "data.raw_url").String(), nil
+// alistObject 将 Alist 返回的文件信息转换为 Object
+func alistObject(dir string, value gjson.Result) Object {
+	name := value.Get("name").String()
+	modified, _ := time.Parse(time.RFC3339, value.Get("modified").String())
+	return Object{
+		Name:     name,
+		Path:     path.Join("/", dir, name),
+		Size:     value.Get("size").Int(),
+		IsDir:    value.Get("is_dir").Bool(),
+		Modified: modified,
+	}
 }
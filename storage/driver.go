@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"qlist/config"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound 文件或目录不存在
+	ErrNotFound = errors.New("文件不存在")
+	// ErrNoLink 驱动无法提供下载地址，需通过 Opener 由服务端转发文件内容
+	ErrNoLink = errors.New("存储驱动不提供下载链接")
+)
+
+// Object 存储中的文件或目录
+type Object struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	IsDir    bool      `json:"isDir"`
+	Modified time.Time `json:"modified"`
+}
+
+// Driver 存储驱动接口，路径均为以 / 开头的绝对路径
+type Driver interface {
+	// List 列出目录下的文件和子目录
+	List(ctx context.Context, dir string) ([]Object, error)
+	// Stat 获取文件或目录信息，不存在时返回 ErrNotFound
+	Stat(ctx context.Context, path string) (*Object, error)
+	// Link 获取文件的下载地址
+	Link(ctx context.Context, path string) (string, error)
+	// Put 上传文件，size 未知时传 -1
+	Put(ctx context.Context, path string, r io.Reader, size int64, contentType string) error
+	// Delete 删除文件或目录
+	Delete(ctx context.Context, path string) error
+	// Move 移动或重命名文件
+	Move(ctx context.Context, src, dst string) error
+	// MakeDir 创建目录，父目录不存在时一并创建
+	MakeDir(ctx context.Context, path string) error
+}
+
+// Opener 可由服务端直接读取文件内容的驱动，返回的内容需支持 Seek 以响应 Range 请求
+type Opener interface {
+	Open(ctx context.Context, path string) (io.ReadSeekCloser, *Object, error)
+}
+
+// Factory 根据配置创建存储驱动
+type Factory func(cfg config.StorageConfig) (Driver, error)
+
+var (
+	mu            sync.RWMutex
+	factories     = map[string]Factory{}
+	defaultDriver Driver
+	// domainDrivers 配置文件中按站点域名配置的存储
+	domainDrivers = map[string]Driver{}
+)
+
+// Register 注册存储驱动，通常在驱动文件的 init 中调用
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[name] = factory
+}
+
+// New 根据配置创建存储驱动
+func New(cfg config.StorageConfig) (Driver, error) {
+	mu.RLock()
+	factory, ok := factories[cfg.Driver]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不支持的存储驱动: %s", cfg.Driver)
+	}
+	return factory(cfg)
+}
+
+// Init 根据配置文件初始化默认存储驱动和按站点配置的存储驱动
+func Init() error {
+	driver, err := New(config.Instance.EffectiveStorage())
+	if err != nil {
+		return err
+	}
+
+	domains := make(map[string]Driver, len(config.Instance.SiteStorages))
+	for domain, cfg := range config.Instance.SiteStorages {
+		siteDriver, err := New(cfg)
+		if err != nil {
+			return fmt.Errorf("站点 %s 的存储配置错误: %w", domain, err)
+		}
+		domains[domain] = siteDriver
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	defaultDriver = driver
+	domainDrivers = domains
+	return nil
+}
+
+// Default 返回默认存储驱动
+func Default() Driver {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultDriver
+}
+
+// SetDefault 替换默认存储驱动，测试时可注入假实现
+func SetDefault(driver Driver) {
+	mu.Lock()
+	defer mu.Unlock()
+	defaultDriver = driver
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"qlist/config"
+	"strings"
+)
+
+var (
+	// ErrLocalNotAllowed 本地存储的根目录不在运维配置的目录下
+	ErrLocalNotAllowed = errors.New("本地存储的根目录不在允许的范围内")
+	// ErrEndpointNotAllowed 存储服务地址不在允许的列表中
+	ErrEndpointNotAllowed = errors.New("存储服务地址不在允许的列表中")
+)
+
+// CheckSiteConfig 检查站点管理员提交的存储配置是否在 site_storage_limits 允许的范围内
+// 本地存储的根目录会被改写为解析符号链接后的绝对路径
+func CheckSiteConfig(cfg *config.StorageConfig) error {
+	mu.RLock()
+	_, ok := factories[cfg.Driver]
+	mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("不支持的存储驱动: %s", cfg.Driver)
+	}
+
+	limits := config.Instance.SiteStorageLimits
+	if cfg.Driver == "local" {
+		root, err := localRootWithin(limits.LocalBaseDir, cfg.Root)
+		if err != nil {
+			return err
+		}
+		cfg.Root = root
+		return nil
+	}
+
+	endpoint := parseEndpoint(cfg.Endpoint)
+	if endpoint == nil {
+		return ErrEndpointNotAllowed
+	}
+	for _, allowed := range limits.AllowedEndpoints {
+		if matchHost(allowed, endpoint) {
+			return nil
+		}
+	}
+	return ErrEndpointNotAllowed
+}
+
+// localRootWithin 返回位于 base 下的根目录的真实路径，不存在或越界时统一返回 ErrLocalNotAllowed，避免借此探测主机上的目录
+func localRootWithin(base, root string) (string, error) {
+	if base == "" || root == "" {
+		return "", ErrLocalNotAllowed
+	}
+	realBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		return "", ErrLocalNotAllowed
+	}
+	realBase, err = filepath.Abs(realBase)
+	if err != nil {
+		return "", ErrLocalNotAllowed
+	}
+	if !filepath.IsAbs(root) {
+		root = filepath.Join(realBase, root)
+	}
+	// 先按字面路径检查，再检查解析符号链接后的路径
+	if !within(realBase, filepath.Clean(root)) {
+		return "", ErrLocalNotAllowed
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil || !within(realBase, realRoot) {
+		return "", ErrLocalNotAllowed
+	}
+	return realRoot, nil
+}
+
+// within 判断 p 是否为 base 或其子路径
+func within(base, p string) bool {
+	rel, err := filepath.Rel(base, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// parseEndpoint 解析存储服务地址，s3 的地址可以不带协议
+func parseEndpoint(endpoint string) *url.URL {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return nil
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" || u.User != nil {
+		return nil
+	}
+	return u
+}
+
+// matchHost 判断地址是否匹配允许的规则，未写端口的规则匹配任意端口，*.example.com 匹配其子域名
+func matchHost(pattern string, u *url.URL) bool {
+	rule, err := url.Parse("//" + strings.TrimSpace(pattern))
+	if err != nil || rule.Hostname() == "" {
+		return false
+	}
+	if rule.Port() != "" && rule.Port() != u.Port() {
+		return false
+	}
+	hostname, ruleHost := strings.ToLower(u.Hostname()), strings.ToLower(rule.Hostname())
+	if suffix, ok := strings.CutPrefix(ruleHost, "*."); ok {
+		return strings.HasSuffix(hostname, "."+suffix)
+	}
+	return hostname == ruleHost
+}
@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"qlist/config"
+	"strings"
+)
+
+func init() {
+	Register("local", func(cfg config.StorageConfig) (Driver, error) {
+		return NewLocalDriver(cfg.Root)
+	})
+}
+
+// errOutsideRoot 路径经符号链接解析后位于根目录之外，按文件不存在处理，不暴露根目录外的信息
+var errOutsideRoot = fmt.Errorf("%w: 路径超出存储根目录", ErrNotFound)
+
+// LocalDriver 以本地目录作为存储的驱动，所有路径都限制在根目录内
+type LocalDriver struct {
+	Root string
+}
+
+// NewLocalDriver 创建本地存储驱动，根目录必须已存在
+func NewLocalDriver(root string) (*LocalDriver, error) {
+	if root == "" {
+		return nil, errors.New("本地存储未配置根目录")
+	}
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	// 根目录本身是符号链接时以其真实路径为准，便于后续做越界检查
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("本地存储根目录不可用: %w", err)
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return nil, fmt.Errorf("本地存储根目录不可用: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("本地存储根目录不是目录: %s", root)
+	}
+	return &LocalDriver{Root: real}, nil
+}
+
+// resolve 将存储路径转换为根目录下的本地路径
+// 先按 / 规整路径去掉 ..，再检查符号链接是否指向根目录之外
+func (d *LocalDriver) resolve(p string) (string, error) {
+	full := filepath.Join(d.Root, filepath.FromSlash(path.Clean("/"+p)))
+
+	// 路径尚不存在时（上传、建目录）检查最近一级已存在的父目录
+	existing := full
+	for {
+		real, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			rel, err := filepath.Rel(d.Root, real)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return "", errOutsideRoot
+			}
+			return full, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return "", errOutsideRoot
+		}
+		existing = parent
+	}
+}
+
+// List 列出目录下的文件和子目录
+func (d *LocalDriver) List(ctx context.Context, dir string) ([]Object, error) {
+	full, err := d.resolve(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(full)
+	if err != nil {
+		return nil, localError(err)
+	}
+
+	objects := make([]Object, 0, len(entries))
+	for _, entry := range entries {
+		entryPath := path.Join("/", dir, entry.Name())
+		info, err := entry.Info()
+		if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			// 符号链接按目标展示，指向根目录之外或已失效的链接不列出
+			var target string
+			if target, err = d.resolve(entryPath); err == nil {
+				info, err = os.Stat(target)
+			}
+		}
+		if err != nil {
+			// 列目录期间被删除的文件直接跳过
+			continue
+		}
+		objects = append(objects, localObject(entryPath, info))
+	}
+	return objects, nil
+}
+
+// Stat 获取文件或目录信息
+func (d *LocalDriver) Stat(ctx context.Context, filePath string) (*Object, error) {
+	full, err := d.resolve(filePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		return nil, localError(err)
+	}
+	object := localObject(path.Clean("/"+filePath), info)
+	return &object, nil
+}
+
+// Link 本地文件没有可供外部访问的地址，由服务端通过 Open 转发
+func (d *LocalDriver) Link(ctx context.Context, filePath string) (string, error) {
+	object, err := d.Stat(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+	if object.IsDir {
+		return "", fmt.Errorf("%s 是目录", filePath)
+	}
+	return "", ErrNoLink
+}
+
+// Open 打开文件用于读取
+func (d *LocalDriver) Open(ctx context.Context, filePath string) (io.ReadSeekCloser, *Object, error) {
+	full, err := d.resolve(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(full)
+	if err != nil {
+		return nil, nil, localError(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s 是目录", filePath)
+	}
+	object := localObject(path.Clean("/"+filePath), info)
+	return file, &object, nil
+}
+
+// Put 上传文件，先写入同目录的临时文件再重命名，避免读到写了一半的文件
+func (d *LocalDriver) Put(ctx context.Context, filePath string, r io.Reader, size int64, contentType string) error {
+	full, err := d.resolve(filePath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(full), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	// 临时文件默认仅所有者可读，改为普通文件的权限
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), full)
+}
+
+// Delete 删除文件或目录，不允许删除根目录
+func (d *LocalDriver) Delete(ctx context.Context, filePath string) error {
+	full, err := d.resolve(filePath)
+	if err != nil {
+		return err
+	}
+	if full == d.Root {
+		return errors.New("不能删除存储根目录")
+	}
+	if _, err := os.Lstat(full); err != nil {
+		return localError(err)
+	}
+	return os.RemoveAll(full)
+}
+
+// Move 移动或重命名文件
+func (d *LocalDriver) Move(ctx context.Context, src, dst string) error {
+	srcFull, err := d.resolve(src)
+	if err != nil {
+		return err
+	}
+	dstFull, err := d.resolve(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dstFull), 0o755); err != nil {
+		return err
+	}
+	return localError(os.Rename(srcFull, dstFull))
+}
+
+// MakeDir 创建目录
+func (d *LocalDriver) MakeDir(ctx context.Context, dir string) error {
+	full, err := d.resolve(dir)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(full, 0o755)
+}
+
+// localError 将文件不存在的错误统一为 ErrNotFound
+func localError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// localObject 将本地文件信息转换为 Object
+func localObject(filePath string, info fs.FileInfo) Object {
+	if info.IsDir() {
+		return Object{Name: path.Base(filePath), Path: filePath, IsDir: true, Modified: info.ModTime()}
+	}
+	return Object{
+		Name:     info.Name(),
+		Path:     filePath,
+		Size:     info.Size(),
+		IsDir:    info.IsDir(),
+		Modified: info.ModTime(),
+	}
+}
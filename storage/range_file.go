@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// rangeFetcher 发起带 Range 请求头的 GET 请求
+type rangeFetcher func(ctx context.Context, header http.Header) (*http.Response, error)
+
+// rangeFile 支持 Seek 的远程文件，每次 Seek 后重新发起 Range 请求
+type rangeFile struct {
+	ctx    context.Context
+	fetch  rangeFetcher
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// newRangeFile 创建远程文件，首次读取时才发起请求
+func newRangeFile(ctx context.Context, size int64, fetch rangeFetcher) *rangeFile {
+	return &rangeFile{ctx: ctx, fetch: fetch, size: size}
+}
+
+// Read 从当前位置读取，首次读取时才发起请求
+func (f *rangeFile) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if f.body == nil {
+		header := http.Header{}
+		header.Set("Range", fmt.Sprintf("bytes=%d-", f.offset))
+		resp, err := f.fetch(f.ctx, header)
+		if err != nil {
+			return 0, err
+		}
+		// 服务端不支持 Range 时返回完整内容，需要跳过已读部分
+		if resp.StatusCode != http.StatusPartialContent && f.offset > 0 {
+			if _, err := io.CopyN(io.Discard, resp.Body, f.offset); err != nil {
+				resp.Body.Close()
+				return 0, err
+			}
+		}
+		f.body = resp.Body
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+// Seek 只记录位置，下次读取时从新位置开始请求
+func (f *rangeFile) Seek(offset int64, whence int) (int64, error) {
+	var next int64
+	switch whence {
+	case io.SeekStart:
+		next = offset
+	case io.SeekCurrent:
+		next = f.offset + offset
+	case io.SeekEnd:
+		next = f.size + offset
+	default:
+		return 0, errors.New("无效的 whence")
+	}
+	if next < 0 {
+		return 0, errors.New("无效的偏移量")
+	}
+	if next != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = next
+	return next, nil
+}
+
+// Close 关闭当前的响应
+func (f *rangeFile) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body = nil
+	return err
+}
@@ -0,0 +1,310 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"qlist/config"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func init() {
+	Register("s3", func(cfg config.StorageConfig) (Driver, error) {
+		return NewS3Driver(cfg)
+	})
+}
+
+const (
+	// s3DefaultLinkExpires 预签名下载链接的默认有效期
+	s3DefaultLinkExpires = time.Hour
+	// s3PartSize 分片上传的分片大小，大小未知的流按此大小缓冲，最多支持 10000 个分片
+	s3PartSize = 16 << 20
+)
+
+// S3Driver 基于 S3 兼容对象存储（MinIO、Ceph RGW、Cloudflare R2 等）的驱动
+// 对象存储没有真正的目录，以 / 分隔的前缀视为目录，空目录用以 / 结尾的空对象占位
+type S3Driver struct {
+	client      *minio.Client
+	bucket      string
+	prefix      string
+	linkExpires time.Duration
+}
+
+// NewS3Driver 根据配置创建 S3 驱动，endpoint 可带 http:// 前缀以连接本地 MinIO
+func NewS3Driver(cfg config.StorageConfig) (*S3Driver, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3 存储需要配置 endpoint 和 bucket")
+	}
+
+	host, secure := cfg.Endpoint, true
+	if strings.Contains(cfg.Endpoint, "://") {
+		u, err := url.Parse(cfg.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("s3 endpoint 格式错误: %w", err)
+		}
+		host, secure = u.Host, u.Scheme == "https"
+	}
+
+	client, err := minio.New(host, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: secure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	linkExpires := s3DefaultLinkExpires
+	if cfg.LinkExpires > 0 {
+		linkExpires = time.Duration(cfg.LinkExpires) * time.Second
+	}
+	return &S3Driver{
+		client:      client,
+		bucket:      cfg.Bucket,
+		prefix:      strings.Trim(cfg.Root, "/"),
+		linkExpires: linkExpires,
+	}, nil
+}
+
+// key 将存储路径转换为对象键，根目录对应空字符串
+func (d *S3Driver) key(p string) string {
+	return strings.TrimPrefix(path.Join(d.prefix, path.Clean("/"+p)), "/")
+}
+
+// dirPrefix 返回目录下对象的公共前缀
+func (d *S3Driver) dirPrefix(dir string) string {
+	if key := d.key(dir); key != "" {
+		return key + "/"
+	}
+	return ""
+}
+
+// List 列出目录下的对象，公共前缀作为子目录返回
+func (d *S3Driver) List(ctx context.Context, dir string) ([]Object, error) {
+	prefix := d.dirPrefix(dir)
+
+	// 提前返回时取消列举，否则列举的 goroutine 会一直阻塞在发送上
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var objects []Object
+	found := path.Clean("/"+dir) == "/"
+	for info := range d.client.ListObjects(ctx, d.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if info.Err != nil {
+			return nil, s3Error(info.Err)
+		}
+		found = true
+		// 目录占位对象本身不列出
+		if info.Key == prefix {
+			continue
+		}
+		objects = append(objects, s3Object(path.Join("/", dir), info))
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+	return objects, nil
+}
+
+// Stat 获取对象信息，对象不存在但有同名前缀时视为目录
+func (d *S3Driver) Stat(ctx context.Context, filePath string) (*Object, error) {
+	filePath = path.Clean("/" + filePath)
+	if key := d.key(filePath); key != "" {
+		info, err := d.client.StatObject(ctx, d.bucket, key, minio.StatObjectOptions{})
+		if err == nil {
+			object := s3Object(path.Dir(filePath), info)
+			return &object, nil
+		}
+		if err = s3Error(err); err != ErrNotFound {
+			return nil, err
+		}
+	}
+
+	isDir, err := d.isDir(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if !isDir {
+		return nil, ErrNotFound
+	}
+	return &Object{Name: path.Base(filePath), Path: filePath, IsDir: true}, nil
+}
+
+// isDir 判断前缀下是否存在对象
+func (d *S3Driver) isDir(ctx context.Context, dir string) (bool, error) {
+	prefix := d.dirPrefix(dir)
+	if prefix == "" {
+		return true, nil
+	}
+	// 只需要第一个结果，返回时取消剩余的列举
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for info := range d.client.ListObjects(ctx, d.bucket, minio.ListObjectsOptions{Prefix: prefix, MaxKeys: 1}) {
+		if info.Err != nil {
+			return false, s3Error(info.Err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Link 生成限时的预签名下载地址，生成前确认对象存在
+func (d *S3Driver) Link(ctx context.Context, filePath string) (string, error) {
+	key := d.key(filePath)
+	if key == "" {
+		return "", fmt.Errorf("%s 是目录", filePath)
+	}
+	if _, err := d.client.StatObject(ctx, d.bucket, key, minio.StatObjectOptions{}); err != nil {
+		return "", s3Error(err)
+	}
+
+	params := url.Values{}
+	params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(key)}))
+	u, err := d.client.PresignedGetObject(ctx, d.bucket, key, d.linkExpires, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// Open 读取对象内容，返回的对象支持 Seek，按需发起 Range 请求
+func (d *S3Driver) Open(ctx context.Context, filePath string) (io.ReadSeekCloser, *Object, error) {
+	key := d.key(filePath)
+	if key == "" {
+		return nil, nil, fmt.Errorf("%s 是目录", filePath)
+	}
+	reader, err := d.client.GetObject(ctx, d.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s3Error(err)
+	}
+	info, err := reader.Stat()
+	if err != nil {
+		reader.Close()
+		return nil, nil, s3Error(err)
+	}
+	object := s3Object(path.Dir(path.Clean("/"+filePath)), info)
+	return reader, &object, nil
+}
+
+// Put 上传对象，超过分片大小或大小未知时自动使用分片上传
+func (d *S3Driver) Put(ctx context.Context, filePath string, r io.Reader, size int64, contentType string) error {
+	key := d.key(filePath)
+	if key == "" {
+		return errors.New("文件路径不能为空")
+	}
+	_, err := d.client.PutObject(ctx, d.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s3PartSize,
+	})
+	return err
+}
+
+// Delete 删除对象，路径为目录时删除前缀下的全部对象
+func (d *S3Driver) Delete(ctx context.Context, filePath string) error {
+	object, err := d.Stat(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	if !object.IsDir {
+		return d.client.RemoveObject(ctx, d.bucket, d.key(filePath), minio.RemoveObjectOptions{})
+	}
+
+	prefix := d.dirPrefix(filePath)
+	if prefix == "" {
+		return errors.New("不能删除存储根目录")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	objects := d.client.ListObjects(ctx, d.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true})
+	for result := range d.client.RemoveObjects(ctx, d.bucket, objects, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil {
+			return result.Err
+		}
+	}
+	return nil
+}
+
+// Move 复制后删除源对象，目录会逐个移动前缀下的对象
+func (d *S3Driver) Move(ctx context.Context, src, dst string) error {
+	object, err := d.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+	if !object.IsDir {
+		return d.moveObject(ctx, d.key(src), d.key(dst))
+	}
+
+	srcPrefix, dstPrefix := d.dirPrefix(src), d.dirPrefix(dst)
+	if srcPrefix == "" || dstPrefix == "" {
+		return errors.New("不能移动存储根目录")
+	}
+	// 出错提前返回时取消剩余的列举
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for info := range d.client.ListObjects(ctx, d.bucket, minio.ListObjectsOptions{Prefix: srcPrefix, Recursive: true}) {
+		if info.Err != nil {
+			return s3Error(info.Err)
+		}
+		if err := d.moveObject(ctx, info.Key, dstPrefix+strings.TrimPrefix(info.Key, srcPrefix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveObject 在桶内移动单个对象
+func (d *S3Driver) moveObject(ctx context.Context, srcKey, dstKey string) error {
+	if dstKey == "" {
+		return errors.New("目标路径不能为空")
+	}
+	_, err := d.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: d.bucket, Object: dstKey},
+		minio.CopySrcOptions{Bucket: d.bucket, Object: srcKey},
+	)
+	if err != nil {
+		return s3Error(err)
+	}
+	return d.client.RemoveObject(ctx, d.bucket, srcKey, minio.RemoveObjectOptions{})
+}
+
+// MakeDir 写入以 / 结尾的空对象作为目录占位
+func (d *S3Driver) MakeDir(ctx context.Context, dir string) error {
+	prefix := d.dirPrefix(dir)
+	if prefix == "" {
+		return nil
+	}
+	_, err := d.client.PutObject(ctx, d.bucket, prefix, strings.NewReader(""), 0, minio.PutObjectOptions{})
+	return err
+}
+
+// s3Error 将对象或桶不存在的错误统一为 ErrNotFound
+func s3Error(err error) error {
+	resp := minio.ToErrorResponse(err)
+	if resp.StatusCode == http.StatusNotFound || resp.Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
+
+// s3Object 将对象信息转换为 Object，以 / 结尾的键为目录
+func s3Object(dir string, info minio.ObjectInfo) Object {
+	name := path.Base(info.Key)
+	if strings.HasSuffix(info.Key, "/") {
+		return Object{Name: name, Path: path.Join("/", dir, name), IsDir: true}
+	}
+	return Object{
+		Name:     name,
+		Path:     path.Join("/", dir, name),
+		Size:     info.Size,
+		Modified: info.LastModified,
+	}
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+)
+
+// scopedDriver 以另一个驱动中的子目录作为根目录，路径无法越过该子目录
+type scopedDriver struct {
+	base   Driver
+	prefix string
+}
+
+// scopedOpener 底层驱动支持 Opener 时的 scopedDriver
+type scopedOpener struct {
+	scopedDriver
+}
+
+// Scoped 返回以 base 中 prefix 目录为根目录的驱动，底层驱动支持 Opener 时返回的驱动同样支持
+func Scoped(base Driver, prefix string) Driver {
+	d := scopedDriver{base: base, prefix: path.Clean("/" + prefix)}
+	if _, ok := base.(Opener); ok {
+		return &scopedOpener{d}
+	}
+	return &d
+}
+
+// SiteDir 返回站点在默认存储中的子目录，以域名命名，域名中文件名不支持的字符替换为 _
+func SiteDir(domain string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(domain))
+	if strings.Trim(name, ".") == "" {
+		name = "_"
+	}
+	return "/" + name
+}
+
+// full 将站点内的路径转换为底层驱动中的路径
+func (d *scopedDriver) full(p string) string {
+	return path.Join(d.prefix, path.Clean("/"+p))
+}
+
+// object 将底层驱动返回的路径转换为站点内的路径
+func (d *scopedDriver) object(obj *Object) *Object {
+	rel := strings.TrimPrefix(obj.Path, d.prefix)
+	if rel == "" {
+		rel = "/"
+	}
+	obj.Path = rel
+	return obj
+}
+
+func (d *scopedDriver) List(ctx context.Context, dir string) ([]Object, error) {
+	objects, err := d.base.List(ctx, d.full(dir))
+	if err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		d.object(&objects[i])
+	}
+	return objects, nil
+}
+
+func (d *scopedDriver) Stat(ctx context.Context, p string) (*Object, error) {
+	obj, err := d.base.Stat(ctx, d.full(p))
+	if err != nil {
+		return nil, err
+	}
+	return d.object(obj), nil
+}
+
+func (d *scopedDriver) Link(ctx context.Context, p string) (string, error) {
+	return d.base.Link(ctx, d.full(p))
+}
+
+func (d *scopedDriver) Put(ctx context.Context, p string, r io.Reader, size int64, contentType string) error {
+	return d.base.Put(ctx, d.full(p), r, size, contentType)
+}
+
+func (d *scopedDriver) Delete(ctx context.Context, p string) error {
+	return d.base.Delete(ctx, d.full(p))
+}
+
+func (d *scopedDriver) Move(ctx context.Context, src, dst string) error {
+	return d.base.Move(ctx, d.full(src), d.full(dst))
+}
+
+func (d *scopedDriver) MakeDir(ctx context.Context, p string) error {
+	return d.base.MakeDir(ctx, d.full(p))
+}
+
+func (d *scopedOpener) Open(ctx context.Context, p string) (io.ReadSeekCloser, *Object, error) {
+	content, obj, err := d.base.(Opener).Open(ctx, d.full(p))
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, d.object(obj), nil
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"fmt"
+	"qlist/config"
+	"qlist/db"
+	"qlist/models"
+	"qlist/pkg/secret"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+var (
+	siteMu sync.Mutex
+	// siteDrivers 按站点 ID 缓存的存储驱动，值为 nil 表示站点没有单独配置
+	siteDrivers = map[uint]Driver{}
+	// siteGenerations 站点存储配置的版本，每次 Invalidate 加一，加载期间配置变更时不缓存旧驱动
+	siteGenerations = map[uint]uint64{}
+)
+
+// ForSite 返回站点使用的存储驱动
+// 优先使用数据库中的站点存储配置，其次是配置文件中按域名的配置，
+// 都没有时使用默认存储中以域名命名的子目录，站点之间不共用同一个根目录；
+// 配置了 shared_storage_root 时使用默认存储的根目录
+func ForSite(site *models.Site) (Driver, error) {
+	siteMu.Lock()
+	driver, cached := siteDrivers[site.ID]
+	generation := siteGenerations[site.ID]
+	siteMu.Unlock()
+	if !cached {
+		var err error
+		if driver, err = loadSiteDriver(site.ID); err != nil {
+			return nil, err
+		}
+		siteMu.Lock()
+		if siteGenerations[site.ID] == generation {
+			siteDrivers[site.ID] = driver
+		}
+		siteMu.Unlock()
+	}
+	if driver != nil {
+		return driver, nil
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	if driver, ok := domainDrivers[site.Domain]; ok {
+		return driver, nil
+	}
+	if defaultDriver == nil {
+		return nil, fmt.Errorf("站点 %s 未配置存储", site.Domain)
+	}
+	if config.Instance.SharedStorageRoot {
+		return defaultDriver, nil
+	}
+	return Scoped(defaultDriver, SiteDir(site.Domain)), nil
+}
+
+// Invalidate 站点存储配置变更后清除缓存的驱动
+func Invalidate(siteID uint) {
+	siteMu.Lock()
+	defer siteMu.Unlock()
+	delete(siteDrivers, siteID)
+	siteGenerations[siteID]++
+}
+
+// loadSiteDriver 根据数据库中的配置创建站点的存储驱动，未配置时返回 nil
+func loadSiteDriver(siteID uint) (Driver, error) {
+	var record models.SiteStorage
+	err := db.GetDB().Where("site_id = ?", siteID).First(&record).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := SiteStorageConfig(&record)
+	if err != nil {
+		return nil, err
+	}
+	// 限制收紧后，之前保存的越界配置不再生效
+	if err := CheckSiteConfig(&cfg); err != nil {
+		return nil, fmt.Errorf("站点存储配置不可用: %w", err)
+	}
+	return New(cfg)
+}
+
+// SiteStorageConfig 将数据库中的站点存储配置转换为驱动配置，并解密其中的凭据
+func SiteStorageConfig(record *models.SiteStorage) (config.StorageConfig, error) {
+	password, err := secret.Decrypt(record.Password)
+	if err != nil {
+		return config.StorageConfig{}, fmt.Errorf("解密存储密码失败: %w", err)
+	}
+	secretKey, err := secret.Decrypt(record.SecretKey)
+	if err != nil {
+		return config.StorageConfig{}, fmt.Errorf("解密存储密钥失败: %w", err)
+	}
+	return config.StorageConfig{
+		Driver:      record.Driver,
+		Endpoint:    record.Endpoint,
+		Username:    record.Username,
+		Password:    password,
+		Root:        record.Root,
+		Bucket:      record.Bucket,
+		Region:      record.Region,
+		AccessKey:   record.AccessKey,
+		SecretKey:   secretKey,
+		LinkExpires: record.LinkExpires,
+	}, nil
+}
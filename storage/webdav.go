@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"qlist/config"
+	"strings"
+)
+
+func init() {
+	Register("webdav", func(cfg config.StorageConfig) (Driver, error) {
+		return NewWebDAVDriver(cfg)
+	})
+}
+
+// webdavPropfindBody PROPFIND 只请求列表需要的属性
+const webdavPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/></d:prop></d:propfind>`
+
+// WebDAVDriver 基于 WebDAV 协议（Nextcloud、ownCloud 等）的存储驱动
+// WebDAV 的文件需要认证才能访问，不提供直链，下载由服务端通过 Open 转发
+type WebDAVDriver struct {
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewWebDAVDriver 根据配置创建 WebDAV 驱动，endpoint 为共享的根地址
+// 例如 Nextcloud 的 https://cloud.example.com/remote.php/dav/files/<用户名>
+func NewWebDAVDriver(cfg config.StorageConfig) (*WebDAVDriver, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("webdav 存储需要配置 endpoint")
+	}
+	base, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("webdav endpoint 格式错误: %w", err)
+	}
+	if cfg.Root != "" {
+		base.Path = path.Join(base.Path, cfg.Root)
+	}
+	return &WebDAVDriver{
+		base:     base,
+		username: cfg.Username,
+		password: cfg.Password,
+		// 不设置整体超时，避免大文件的下载和上传被中断
+		client: &http.Client{Transport: http.DefaultTransport},
+	}, nil
+}
+
+// url 将存储路径转换为请求地址，目录以 / 结尾
+func (d *WebDAVDriver) url(p string, isDir bool) string {
+	u := *d.base
+	u.Path = path.Join(d.base.Path, path.Clean("/"+p))
+	if isDir && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.String()
+}
+
+// do 发送带认证信息的请求，404 转换为 ErrNotFound
+func (d *WebDAVDriver) do(ctx context.Context, method, target string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if d.username != "" || d.password != "" {
+		req.SetBasicAuth(d.username, d.password)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("WebDAV 认证失败: %s", resp.Status)
+	default:
+		return nil, fmt.Errorf("WebDAV %s 请求失败: %s", method, resp.Status)
+	}
+}
+
+// webdavMultistatus PROPFIND 返回的 207 响应
+type webdavMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				ContentLength int64  `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// propfind 查询路径本身（depth 0）或目录下一级（depth 1）的属性
+func (d *WebDAVDriver) propfind(ctx context.Context, p string, depth string) ([]Object, error) {
+	header := http.Header{}
+	header.Set("Depth", depth)
+	header.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := d.do(ctx, "PROPFIND", d.url(p, depth != "0"), strings.NewReader(webdavPropfindBody), header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result webdavMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("解析 WebDAV 响应失败: %w", err)
+	}
+
+	dir := path.Clean("/" + p)
+	objects := make([]Object, 0, len(result.Responses))
+	for _, r := range result.Responses {
+		hrefPath := r.Href
+		if u, err := url.Parse(r.Href); err == nil {
+			hrefPath = u.Path
+		}
+		// href 为服务端的完整路径，去掉共享根路径后得到存储路径
+		rel := path.Clean("/" + strings.TrimPrefix(path.Clean(hrefPath), path.Clean(d.base.Path)))
+
+		object := Object{Name: path.Base(rel), Path: rel}
+		for _, propstat := range r.Propstat {
+			if !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+			object.IsDir = propstat.Prop.ResourceType.Collection != nil
+			object.Size = propstat.Prop.ContentLength
+			object.Modified, _ = http.ParseTime(propstat.Prop.LastModified)
+		}
+		if depth != "0" && rel == dir {
+			// 目录自身
+			continue
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// List 列出目录下的文件和子目录
+func (d *WebDAVDriver) List(ctx context.Context, dir string) ([]Object, error) {
+	return d.propfind(ctx, dir, "1")
+}
+
+// Stat 获取文件或目录信息
+func (d *WebDAVDriver) Stat(ctx context.Context, filePath string) (*Object, error) {
+	objects, err := d.propfind(ctx, filePath, "0")
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, ErrNotFound
+	}
+	object := objects[0]
+	object.Path = path.Clean("/" + filePath)
+	object.Name = path.Base(object.Path)
+	return &object, nil
+}
+
+// Link 确认文件存在，下载需由服务端通过 Open 转发
+func (d *WebDAVDriver) Link(ctx context.Context, filePath string) (string, error) {
+	object, err := d.Stat(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+	if object.IsDir {
+		return "", fmt.Errorf("%s 是目录", filePath)
+	}
+	return "", ErrNoLink
+}
+
+// Open 打开文件，读取时按当前位置发起 Range 请求，支持断点续传
+func (d *WebDAVDriver) Open(ctx context.Context, filePath string) (io.ReadSeekCloser, *Object, error) {
+	object, err := d.Stat(ctx, filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if object.IsDir {
+		return nil, nil, fmt.Errorf("%s 是目录", filePath)
+	}
+	target := d.url(filePath, false)
+	fetch := func(ctx context.Context, header http.Header) (*http.Response, error) {
+		return d.do(ctx, http.MethodGet, target, nil, header)
+	}
+	return newRangeFile(ctx, object.Size, fetch), object, nil
+}
+
+// Put 上传文件，父目录不存在时先创建
+func (d *WebDAVDriver) Put(ctx context.Context, filePath string, r io.Reader, size int64, contentType string) error {
+	if err := d.MakeDir(ctx, path.Dir(path.Clean("/"+filePath))); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, d.url(filePath, false), r)
+	if err != nil {
+		return err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if d.username != "" || d.password != "" {
+		req.SetBasicAuth(d.username, d.password)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("WebDAV PUT 请求失败: %s", resp.Status)
+	}
+	return nil
+}
+
+// Delete 删除文件或目录
+func (d *WebDAVDriver) Delete(ctx context.Context, filePath string) error {
+	if path.Clean("/"+filePath) == "/" {
+		return errors.New("不能删除存储根目录")
+	}
+	resp, err := d.do(ctx, http.MethodDelete, d.url(filePath, false), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Move 移动或重命名文件，目标已存在时覆盖
+func (d *WebDAVDriver) Move(ctx context.Context, src, dst string) error {
+	if err := d.MakeDir(ctx, path.Dir(path.Clean("/"+dst))); err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Destination", d.url(dst, false))
+	header.Set("Overwrite", "T")
+	resp, err := d.do(ctx, "MOVE", d.url(src, false), nil, header)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// MakeDir 逐级创建目录，已存在的目录跳过
+func (d *WebDAVDriver) MakeDir(ctx context.Context, dir string) error {
+	current := "/"
+	for _, name := range strings.Split(strings.Trim(path.Clean("/"+dir), "/"), "/") {
+		if name == "" {
+			continue
+		}
+		current = path.Join(current, name)
+
+		req, err := http.NewRequestWithContext(ctx, "MKCOL", d.url(current, true), nil)
+		if err != nil {
+			return err
+		}
+		if d.username != "" || d.password != "" {
+			req.SetBasicAuth(d.username, d.password)
+		}
+		resp, err := d.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		// 405 表示目录已存在
+		if resp.StatusCode >= 300 && resp.StatusCode != http.StatusMethodNotAllowed {
+			return fmt.Errorf("WebDAV 创建目录 %s 失败: %s", current, resp.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// chunkSize 每次写入前申请的字节数，也是令牌桶的最小容量
+const chunkSize = 32 << 10
+
+// ErrTooManyConnections 用户同时下载的连接数已达上限
+var ErrTooManyConnections = errors.New("同时下载的连接数已达上限")
+
+// Limit 单个用户的下载限制，0 表示不限制
+type Limit struct {
+	Rate        int64 // 用户所有连接合计的速度上限（字节/秒）
+	Connections int   // 同时下载的连接数上限
+}
+
+type userKey struct {
+	siteID uint
+	userID uint
+}
+
+// userState 用户正在进行的下载，同一用户的所有连接共用一个令牌桶
+type userState struct {
+	conns   int
+	limiter *rate.Limiter
+}
+
+var (
+	mu    sync.Mutex
+	users = map[userKey]*userState{}
+	sites = map[uint]*rate.Limiter{}
+)
+
+// Conn 一个下载连接占用的配额，下载结束后需调用 Release
+type Conn struct {
+	key     userKey
+	user    *rate.Limiter
+	site    *rate.Limiter
+	release sync.Once
+}
+
+// Acquire 为用户登记一个下载连接，超过连接数上限时返回 ErrTooManyConnections
+// siteRate 为站点所有下载合计的速度上限（字节/秒），0 表示不限制
+func Acquire(siteID, userID uint, limit Limit, siteRate int64) (*Conn, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	key := userKey{siteID, userID}
+	state, ok := users[key]
+	if !ok {
+		state = &userState{limiter: newLimiter(limit.Rate)}
+		users[key] = state
+	}
+	if limit.Connections > 0 && state.conns >= limit.Connections {
+		return nil, ErrTooManyConnections
+	}
+	// 会员等级变化后新连接按新的速度生效，已有连接共用同一个令牌桶，一并生效
+	setRate(state.limiter, limit.Rate)
+	state.conns++
+
+	site, ok := sites[siteID]
+	if !ok {
+		site = newLimiter(siteRate)
+		sites[siteID] = site
+	}
+	setRate(site, siteRate)
+
+	return &Conn{key: key, user: state.limiter, site: site}, nil
+}
+
+// Release 释放连接，用户没有其他连接时清理其状态
+func (c *Conn) Release() {
+	c.release.Do(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if state, ok := users[c.key]; ok {
+			if state.conns--; state.conns <= 0 {
+				delete(users, c.key)
+			}
+		}
+	})
+}
+
+// Writer 返回按用户和站点限速写入的 ResponseWriter，ctx 取消时停止等待
+func (c *Conn) Writer(ctx context.Context, w http.ResponseWriter) http.ResponseWriter {
+	return &writer{ResponseWriter: w, ctx: ctx, conn: c}
+}
+
+// writer 每次写入前从用户和站点的令牌桶申请额度
+type writer struct {
+	http.ResponseWriter
+	ctx  context.Context
+	conn *Conn
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), chunkSize)
+		if err := w.conn.user.WaitN(w.ctx, n); err != nil {
+			return written, err
+		}
+		if err := w.conn.site.WaitN(w.ctx, n); err != nil {
+			return written, err
+		}
+		m, err := w.ResponseWriter.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// newLimiter 创建令牌桶，速度为 0 时不限制
+func newLimiter(bytesPerSecond int64) *rate.Limiter {
+	limiter := rate.NewLimiter(rate.Inf, chunkSize)
+	setRate(limiter, bytesPerSecond)
+	return limiter
+}
+
+// setRate 调整令牌桶的速度，容量为一秒的流量且不小于单次申请的字节数
+func setRate(limiter *rate.Limiter, bytesPerSecond int64) {
+	if bytesPerSecond <= 0 {
+		limiter.SetLimit(rate.Inf)
+		return
+	}
+	if limiter.Limit() == rate.Limit(bytesPerSecond) {
+		return
+	}
+	limiter.SetLimit(rate.Limit(bytesPerSecond))
+	limiter.SetBurst(int(max(bytesPerSecond, chunkSize)))
+}
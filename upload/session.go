@@ -0,0 +1,234 @@
+package upload
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"qlist/config"
+	"qlist/db"
+	"qlist/models"
+	"sync"
+	"time"
+)
+
+const (
+	// SessionTTL 上传会话在最后一次写入后的保留时间
+	SessionTTL = 24 * time.Hour
+	// ChunkSize 建议客户端使用的分片大小，服务端不限制单个分片的大小
+	ChunkSize = 8 << 20
+)
+
+var (
+	// ErrOffsetMismatch 分片的起始位置与已接收的数据不一致，客户端应按返回的偏移量续传
+	ErrOffsetMismatch = errors.New("分片偏移量与已接收的数据不一致")
+	// ErrBusy 同一会话有其他请求正在写入或提交
+	ErrBusy = errors.New("上传会话正在处理其他请求")
+	// ErrTooLarge 上传的数据超过创建会话时声明的大小
+	ErrTooLarge = errors.New("上传的数据超过文件大小")
+	// ErrIncomplete 数据尚未全部接收，不能提交
+	ErrIncomplete = errors.New("文件尚未上传完成")
+)
+
+var (
+	mu   sync.Mutex
+	busy = map[string]bool{}
+)
+
+// Dir 返回保存未完成上传数据的目录
+func Dir() string {
+	if config.Instance.Upload.TempDir != "" {
+		return config.Instance.Upload.TempDir
+	}
+	return filepath.Join(os.TempDir(), "qlist-uploads")
+}
+
+// partPath 返回会话数据文件的路径
+func partPath(id string) string {
+	return filepath.Join(Dir(), id+".part")
+}
+
+// acquire 占用会话，同一会话同时只允许一个请求写入
+func acquire(id string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if busy[id] {
+		return false
+	}
+	busy[id] = true
+	return true
+}
+
+func release(id string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(busy, id)
+}
+
+// Create 创建上传会话和对应的空数据文件
+func Create(session *models.UploadSession) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	session.ID = hex.EncodeToString(b)
+	session.Offset = 0
+	session.ExpiresAt = time.Now().Add(SessionTTL)
+
+	if err := os.MkdirAll(Dir(), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(partPath(session.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	if err := db.GetDB().Create(session).Error; err != nil {
+		os.Remove(partPath(session.ID))
+		return err
+	}
+	return nil
+}
+
+// Append 从 offset 处追加分片数据
+// 连接中断时已写入的部分会保留并记录，客户端查询偏移量后从断点继续
+func Append(ctx context.Context, session *models.UploadSession, offset int64, r io.Reader) error {
+	if !acquire(session.ID) {
+		return ErrBusy
+	}
+	defer release(session.ID)
+
+	file, err := os.OpenFile(partPath(session.ID), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// 以数据文件的实际大小为准，避免上次写入后记录偏移量前进程退出导致不一致
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	received := info.Size()
+	if received > session.Size {
+		if err := file.Truncate(session.Size); err != nil {
+			return err
+		}
+		received = session.Size
+	}
+	if offset != received {
+		if err := saveOffset(session, received); err != nil {
+			return err
+		}
+		return ErrOffsetMismatch
+	}
+
+	if _, err := file.Seek(received, io.SeekStart); err != nil {
+		return err
+	}
+	n, copyErr := io.Copy(file, io.LimitReader(r, session.Size-received))
+	if copyErr == nil {
+		copyErr = ctx.Err()
+	}
+	if copyErr == nil {
+		// 数据在达到声明的大小后仍有剩余
+		var extra [1]byte
+		if m, _ := r.Read(extra[:]); m > 0 {
+			copyErr = ErrTooLarge
+		}
+	}
+	if err := file.Sync(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	if err := saveOffset(session, received+n); err != nil {
+		return err
+	}
+	return copyErr
+}
+
+// Commit 数据全部接收后调用 store 写入存储，成功后删除会话
+func Commit(session *models.UploadSession, store func(r io.Reader) error) error {
+	if !acquire(session.ID) {
+		return ErrBusy
+	}
+	defer release(session.ID)
+
+	file, err := os.Open(partPath(session.ID))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != session.Size {
+		if err := saveOffset(session, info.Size()); err != nil {
+			return err
+		}
+		return ErrIncomplete
+	}
+
+	if err := store(file); err != nil {
+		return err
+	}
+	return remove(session.ID)
+}
+
+// Remove 放弃上传，删除会话和已接收的数据
+func Remove(session *models.UploadSession) error {
+	if !acquire(session.ID) {
+		return ErrBusy
+	}
+	defer release(session.ID)
+	return remove(session.ID)
+}
+
+// StartCleanup 定期清理过期的上传会话
+func StartCleanup(interval time.Duration) {
+	go func() {
+		for {
+			cleanup()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// cleanup 删除过期的会话，正在写入的会话跳过
+func cleanup() {
+	var sessions []models.UploadSession
+	if err := db.GetDB().Where("expires_at < ?", time.Now()).Find(&sessions).Error; err != nil {
+		log.Printf("查询过期上传会话失败: %v", err)
+		return
+	}
+	for i := range sessions {
+		if err := Remove(&sessions[i]); err != nil && err != ErrBusy {
+			log.Printf("清理上传会话 %s 失败: %v", sessions[i].ID, err)
+		}
+	}
+}
+
+// remove 删除会话记录和数据文件，调用方需已占用会话
+func remove(id string) error {
+	if err := os.Remove(partPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return db.GetDB().Delete(&models.UploadSession{}, "id = ?", id).Error
+}
+
+// saveOffset 记录已接收的字节数并延长会话有效期
+func saveOffset(session *models.UploadSession, offset int64) error {
+	session.Offset = offset
+	session.ExpiresAt = time.Now().Add(SessionTTL)
+	return db.GetDB().Model(session).Updates(map[string]interface{}{
+		"received":   offset,
+		"expires_at": session.ExpiresAt,
+	}).Error
+}